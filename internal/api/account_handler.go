@@ -0,0 +1,237 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KartikSindura/money/internal/middleware"
+	"github.com/KartikSindura/money/internal/store"
+	"github.com/KartikSindura/money/utils"
+)
+
+type AccountHandler struct {
+	accountStore store.AccountStore
+	logger       *log.Logger
+}
+
+func NewAccountHandler(accountStore store.AccountStore, logger *log.Logger) *AccountHandler {
+	return &AccountHandler{
+		accountStore: accountStore,
+		logger:       logger,
+	}
+}
+
+func validAccountType(accountType string) bool {
+	switch accountType {
+	case "cash", "bank", "credit", "loan":
+		return true
+	}
+	return false
+}
+
+func (h *AccountHandler) HandleCreateAccount(w http.ResponseWriter, r *http.Request) {
+	account := &store.Account{}
+	err := json.NewDecoder(r.Body).Decode(&account)
+	if err != nil {
+		h.logger.Printf("Error: decodingHandleCreateAccount: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "error decoding account"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+	account.UserID = currentUser.ID
+
+	account.Name = strings.TrimSpace(account.Name)
+	if account.Name == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "name is required"})
+		return
+	}
+	if !validAccountType(account.Type) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "type must be cash, bank, credit or loan"})
+		return
+	}
+
+	// if currency is not provided, use the user's base currency
+	if account.Currency == "" {
+		account.Currency = currentUser.BaseCurrency
+	}
+	account.Currency, err = store.NormalizeCurrency(account.Currency)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	account, err = h.accountStore.CreateAccount(account)
+	if err != nil {
+		h.logger.Printf("Error: HandleCreateAccount: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error creating account"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"account": account})
+}
+
+func (h *AccountHandler) HandleGetAccountByID(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetAccountByID: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	account, err := h.accountStore.GetAccountByID(id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "account not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleGetAccountByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting account"})
+		return
+	}
+
+	if account.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"account": account})
+}
+
+func (h *AccountHandler) HandleGetAccounts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	accounts, err := h.accountStore.GetAccounts(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetAccounts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting accounts"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"accounts": accounts})
+}
+
+func (h *AccountHandler) HandleUpdateAccount(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleUpdateAccount: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	existingAccount, err := h.accountStore.GetAccountByID(id)
+	if err != nil {
+		h.logger.Printf("Error: HandleUpdateAccount: %v", err)
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "cannot find account"})
+		return
+	}
+	if existingAccount.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+
+	// the currency cannot change once transactions are booked against the account
+	var updatedAccountRequest struct {
+		Name           *string      `json:"name"`
+		Type           *string      `json:"type"`
+		OpeningBalance *store.Money `json:"opening_balance"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&updatedAccountRequest)
+	if err != nil {
+		h.logger.Printf("Error: decodingHandleUpdateAccount: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "failed to decode request body"})
+		return
+	}
+
+	if updatedAccountRequest.Name != nil {
+		existingAccount.Name = strings.TrimSpace(*updatedAccountRequest.Name)
+		if existingAccount.Name == "" {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "name is required"})
+			return
+		}
+	}
+	if updatedAccountRequest.Type != nil {
+		if !validAccountType(*updatedAccountRequest.Type) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "type must be cash, bank, credit or loan"})
+			return
+		}
+		existingAccount.Type = *updatedAccountRequest.Type
+	}
+	if updatedAccountRequest.OpeningBalance != nil {
+		existingAccount.Balance += *updatedAccountRequest.OpeningBalance - existingAccount.OpeningBalance
+		existingAccount.OpeningBalance = *updatedAccountRequest.OpeningBalance
+	}
+	existingAccount.UpdatedAt = time.Now()
+
+	err = h.accountStore.UpdateAccount(existingAccount)
+	if err != nil {
+		h.logger.Printf("Error: HandleUpdateAccount: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to update account"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"account": existingAccount})
+}
+
+func (h *AccountHandler) HandleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteAccount: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	account, err := h.accountStore.GetAccountByID(id)
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteAccount: %v", err)
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "account not found"})
+		return
+	}
+	if account.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+
+	err = h.accountStore.DeleteAccountByID(id)
+	if errors.Is(err, store.ErrAccountInUse) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "account not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteAccount: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error deleting account"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status": "account deleted"})
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/KartikSindura/money/internal/middleware"
+	"github.com/KartikSindura/money/internal/store"
+	"github.com/KartikSindura/money/utils"
+)
+
+type APIKeyHandler struct {
+	apiKeyStore store.APIKeyStore
+	logger      *log.Logger
+}
+
+func NewAPIKeyHandler(apiKeyStore store.APIKeyStore, logger *log.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyStore: apiKeyStore,
+		logger:      logger,
+	}
+}
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"` // never expires when left out
+}
+
+func validateAPIKeyRequest(req *createAPIKeyRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(req.Name) > 100 {
+		return errors.New("name must be at most 100 characters")
+	}
+	if len(req.Scopes) == 0 {
+		return fmt.Errorf("scopes are required, choose from %s", strings.Join(store.APIKeyScopes, ", "))
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(store.APIKeyScopes, scope) {
+			return fmt.Errorf("unknown scope %q, choose from %s", scope, strings.Join(store.APIKeyScopes, ", "))
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	return nil
+}
+
+// HandleCreateAPIKey creates a key for scripts. The key is in the response
+// and cannot be shown again.
+func (h *APIKeyHandler) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	var req createAPIKeyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.Printf("Error: decodingCreateAPIKeyRequest: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+	err = validateAPIKeyRequest(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	key, prefix, keyHash, err := store.NewAPIKey()
+	if err != nil {
+		h.logger.Printf("Error: HandleCreateAPIKey: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error creating api key"})
+		return
+	}
+
+	scopes := store.ScopeList{}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	apiKey := &store.APIKey{
+		UserID:    currentUser.ID,
+		Name:      req.Name,
+		Prefix:    prefix,
+		Scopes:    scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+	apiKey, err = h.apiKeyStore.CreateAPIKey(apiKey, keyHash)
+	if err != nil {
+		h.logger.Printf("Error: HandleCreateAPIKey: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error creating api key"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"api_key": apiKey, "key": key})
+}
+
+func (h *APIKeyHandler) HandleGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	apiKeys, err := h.apiKeyStore.GetAPIKeys(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetAPIKeys: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting api keys"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"api_keys": apiKeys})
+}
+
+// HandleDeleteAPIKey revokes a key; requests made with it fail right away.
+func (h *APIKeyHandler) HandleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteAPIKey: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	apiKey, err := h.apiKeyStore.GetAPIKeyByID(id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "api key not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteAPIKey: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting api key"})
+		return
+	}
+	if apiKey.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+
+	err = h.apiKeyStore.DeleteAPIKeyByID(id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "api key not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteAPIKey: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error deleting api key"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status": "api key deleted"})
+}
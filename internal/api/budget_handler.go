@@ -0,0 +1,232 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KartikSindura/money/internal/middleware"
+	"github.com/KartikSindura/money/internal/store"
+	"github.com/KartikSindura/money/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+type BudgetHandler struct {
+	budgetStore   store.BudgetStore
+	categoryStore store.CategoryStore
+	logger        *log.Logger
+}
+
+func NewBudgetHandler(budgetStore store.BudgetStore, categoryStore store.CategoryStore, logger *log.Logger) *BudgetHandler {
+	return &BudgetHandler{
+		budgetStore:   budgetStore,
+		categoryStore: categoryStore,
+		logger:        logger,
+	}
+}
+
+func validMonth(month string) bool {
+	_, err := time.Parse("2006-01", month)
+	return err == nil
+}
+
+func (h *BudgetHandler) HandleSetBudget(w http.ResponseWriter, r *http.Request) {
+	budget := &store.Budget{}
+	err := json.NewDecoder(r.Body).Decode(&budget)
+	if err != nil {
+		h.logger.Printf("Error: decodingHandleSetBudget: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "error decoding budget"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	if budget.Category == nil || *budget.Category == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "category is required"})
+		return
+	}
+	if !validMonth(budget.Month) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "month must be in YYYY-MM format"})
+		return
+	}
+	if budget.Amount < 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "amount must not be negative"})
+		return
+	}
+
+	// budgets limit spending, so a new category is an expense one
+	category := &store.Category{
+		UserID: currentUser.ID,
+		Name:   strings.ToLower(*budget.Category),
+		Kind:   "expense",
+	}
+	category, err = h.categoryStore.FindOrCreateCategoryByName(category)
+	if err != nil {
+		h.logger.Printf("Error: HandleSetBudget: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting category"})
+		return
+	}
+	if !category.Allows("expense") {
+		writeCategoryKindError(w, category)
+		return
+	}
+
+	budget.UserID = currentUser.ID
+	budget.CategoryID = category.ID
+	budget.Category = &category.Path
+
+	budget, err = h.budgetStore.UpsertBudget(budget)
+	if err != nil {
+		h.logger.Printf("Error: HandleSetBudget: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error setting budget"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"budget": budget})
+}
+
+func (h *BudgetHandler) HandleGetBudgets(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	var month *string
+	if monthStr := r.URL.Query().Get("month"); monthStr != "" {
+		if !validMonth(monthStr) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "month must be in YYYY-MM format"})
+			return
+		}
+		month = &monthStr
+	}
+
+	budgets, err := h.budgetStore.GetBudgets(currentUser.ID, month)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetBudgets: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting budgets"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"budgets": budgets})
+}
+
+func (h *BudgetHandler) HandleGetBudgetReport(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	month := chi.URLParam(r, "month")
+	if !validMonth(month) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "month must be in YYYY-MM format"})
+		return
+	}
+
+	report, err := h.budgetStore.GetBudgetReport(currentUser.ID, month)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetBudgetReport: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting budget report"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"report": report})
+}
+
+func (h *BudgetHandler) HandleUpdateBudget(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleUpdateBudget: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	existingBudget, err := h.budgetStore.GetBudgetByID(id)
+	if err != nil {
+		h.logger.Printf("Error: HandleUpdateBudget: %v", err)
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "cannot find budget"})
+		return
+	}
+	if existingBudget.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+
+	var updatedBudgetRequest struct {
+		Amount *store.Money `json:"amount"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&updatedBudgetRequest)
+	if err != nil {
+		h.logger.Printf("Error: decodingHandleUpdateBudget: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "failed to decode request body"})
+		return
+	}
+
+	if updatedBudgetRequest.Amount == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "amount is required"})
+		return
+	}
+	if *updatedBudgetRequest.Amount < 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "amount must not be negative"})
+		return
+	}
+	existingBudget.Amount = *updatedBudgetRequest.Amount
+	existingBudget.UpdatedAt = time.Now()
+
+	err = h.budgetStore.UpdateBudget(existingBudget)
+	if err != nil {
+		h.logger.Printf("Error: HandleUpdateBudget: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to update budget"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"budget": existingBudget})
+}
+
+func (h *BudgetHandler) HandleDeleteBudget(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteBudget: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	budget, err := h.budgetStore.GetBudgetByID(id)
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteBudget: %v", err)
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "budget not found"})
+		return
+	}
+	if budget.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+
+	err = h.budgetStore.DeleteBudgetByID(id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "budget not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteBudget: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error deleting budget"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status": "budget deleted"})
+}
@@ -0,0 +1,596 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/KartikSindura/money/internal/classifier"
+	"github.com/KartikSindura/money/internal/middleware"
+	"github.com/KartikSindura/money/internal/store"
+	"github.com/KartikSindura/money/utils"
+)
+
+type CategoryHandler struct {
+	categoryStore store.CategoryStore
+	classifier    *classifier.Classifier
+	logger        *log.Logger
+}
+
+func NewCategoryHandler(categoryStore store.CategoryStore, classifier *classifier.Classifier, logger *log.Logger) *CategoryHandler {
+	return &CategoryHandler{
+		categoryStore: categoryStore,
+		classifier:    classifier,
+		logger:        logger,
+	}
+}
+
+var colorRegex = regexp.MustCompile(`^#[0-9a-f]{6}$`)
+
+func validCategoryKind(kind string) bool {
+	switch kind {
+	case "expense", "income", "both":
+		return true
+	}
+	return false
+}
+
+// readStyle checks color and icon and turns empty strings into nil, so a
+// client can clear them.
+func readStyle(color *string, icon *string) (*string, *string, error) {
+	if color != nil {
+		*color = strings.ToLower(strings.TrimSpace(*color))
+		if *color == "" {
+			color = nil
+		} else if !colorRegex.MatchString(*color) {
+			return nil, nil, errors.New("color must look like #1e90ff")
+		}
+	}
+	if icon != nil {
+		*icon = strings.TrimSpace(*icon)
+		if *icon == "" {
+			icon = nil
+		}
+	}
+	return color, icon, nil
+}
+
+// checkParent makes sure a parent category exists and belongs to the user.
+func (h *CategoryHandler) checkParent(w http.ResponseWriter, handler string, parentID int64, userID int64) bool {
+	parent, err := h.categoryStore.GetCategoryByID(parentID)
+	if err == sql.ErrNoRows || (err == nil && parent.UserID != userID) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "parent category not found"})
+		return false
+	}
+	if err != nil {
+		h.logger.Printf("Error: %s: %v", handler, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting category"})
+		return false
+	}
+	return true
+}
+
+// HandleGetCategories lists the user's categories sorted by path, or nested
+// under their parents with ?tree=true. ?kind=expense or ?kind=income leaves
+// out the categories meant for the other side.
+func (h *CategoryHandler) HandleGetCategories(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	if kind != "" && kind != "expense" && kind != "income" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "kind must be expense or income"})
+		return
+	}
+
+	var categories []store.Category
+	var err error
+	if r.URL.Query().Get("tree") == "true" {
+		categories, err = h.categoryStore.GetCategoryTree(currentUser.ID, kind)
+	} else {
+		categories, err = h.categoryStore.GetCategories(currentUser.ID, kind)
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleGetCategories: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting categories"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"categories": categories})
+}
+
+const maxSuggestions = 5
+
+// HandleSuggestCategories ranks expense categories for a new expense by how
+// well its note, payee and amount fit the user's past expenses.
+func (h *CategoryHandler) HandleSuggestCategories(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	note := r.URL.Query().Get("note")
+	var payee *string
+	if value := r.URL.Query().Get("payee"); value != "" {
+		payee = &value
+	}
+	if strings.TrimSpace(note) == "" && payee == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "note or payee is required"})
+		return
+	}
+	var amount store.Money
+	if value := r.URL.Query().Get("amount"); value != "" {
+		var err error
+		amount, err = store.ParseMoney(value)
+		if err != nil || amount < 0 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid amount"})
+			return
+		}
+	}
+
+	suggestions, err := h.classifier.Suggest(currentUser.ID, note, payee, amount, maxSuggestions)
+	if err != nil {
+		h.logger.Printf("Error: HandleSuggestCategories: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error suggesting categories"})
+		return
+	}
+
+	categories, err := h.categoryStore.GetCategories(currentUser.ID, "expense")
+	if err != nil {
+		h.logger.Printf("Error: HandleSuggestCategories: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting categories"})
+		return
+	}
+	paths := map[int64]string{}
+	for _, category := range categories {
+		paths[category.ID] = category.Path
+	}
+	// categories no longer meant for expenses are left out
+	ranked := []classifier.Suggestion{}
+	for _, suggestion := range suggestions {
+		if path, ok := paths[suggestion.CategoryID]; ok {
+			suggestion.Category = path
+			ranked = append(ranked, suggestion)
+		}
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"suggestions": ranked})
+}
+
+func (h *CategoryHandler) HandleGetCategoryByID(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetCategoryByID: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	category, err := h.categoryStore.GetCategoryByID(id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "category not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleGetCategoryByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting category"})
+		return
+	}
+
+	if category.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"category": category})
+}
+
+// HandleCreateCategory creates one category, below parent_id when given.
+// The kind defaults to both.
+func (h *CategoryHandler) HandleCreateCategory(w http.ResponseWriter, r *http.Request) {
+	var createCategoryRequest struct {
+		Name     string  `json:"name"`
+		ParentID *int64  `json:"parent_id"`
+		Kind     string  `json:"kind"`
+		Color    *string `json:"color"`
+		Icon     *string `json:"icon"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&createCategoryRequest)
+	if err != nil {
+		h.logger.Printf("Error: decodingHandleCreateCategory: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "error decoding category"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	name := strings.ToLower(strings.TrimSpace(createCategoryRequest.Name))
+	if name == "" || strings.Contains(name, "/") {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "name is required and must not contain '/'"})
+		return
+	}
+	if createCategoryRequest.Kind == "" {
+		createCategoryRequest.Kind = "both"
+	}
+	if !validCategoryKind(createCategoryRequest.Kind) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "kind must be expense, income or both"})
+		return
+	}
+	color, icon, err := readStyle(createCategoryRequest.Color, createCategoryRequest.Icon)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if createCategoryRequest.ParentID != nil && !h.checkParent(w, "HandleCreateCategory", *createCategoryRequest.ParentID, currentUser.ID) {
+		return
+	}
+
+	category, err := h.categoryStore.CreateCategory(&store.Category{
+		UserID:   currentUser.ID,
+		ParentID: createCategoryRequest.ParentID,
+		Name:     name,
+		Kind:     createCategoryRequest.Kind,
+		Color:    color,
+		Icon:     icon,
+	})
+	if errors.Is(err, store.ErrCategoryExists) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleCreateCategory: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error creating category"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"category": category})
+}
+
+// HandleMoveCategory moves a category and its subcategories below
+// parent_id, or to the top level when parent_id is null.
+func (h *CategoryHandler) HandleMoveCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleMoveCategory: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	category, err := h.categoryStore.GetCategoryByID(id)
+	if err != nil {
+		h.logger.Printf("Error: HandleMoveCategory: %v", err)
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "category not found"})
+		return
+	}
+	if category.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+
+	var moveCategoryRequest struct {
+		ParentID *int64 `json:"parent_id"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&moveCategoryRequest)
+	if err != nil {
+		h.logger.Printf("Error: decodingHandleMoveCategory: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "failed to decode request body"})
+		return
+	}
+	if moveCategoryRequest.ParentID != nil && !h.checkParent(w, "HandleMoveCategory", *moveCategoryRequest.ParentID, currentUser.ID) {
+		return
+	}
+
+	err = h.categoryStore.MoveCategory(id, moveCategoryRequest.ParentID)
+	if errors.Is(err, store.ErrCategoryCycle) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, store.ErrCategoryExists) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleMoveCategory: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to move category"})
+		return
+	}
+
+	category, err = h.categoryStore.GetCategoryByID(id)
+	if err != nil {
+		h.logger.Printf("Error: HandleMoveCategory: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting category"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"category": category})
+}
+
+// HandleUpdateCategory renames a category or changes its kind, color and
+// icon. Moving it is done by HandleMoveCategory.
+func (h *CategoryHandler) HandleUpdateCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleUpdateCategory: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	category, err := h.categoryStore.GetCategoryByID(id)
+	if err != nil {
+		h.logger.Printf("Error: HandleUpdateCategory: %v", err)
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "category not found"})
+		return
+	}
+	if category.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+
+	var updatedCategoryRequest struct {
+		Name  *string `json:"name"`
+		Kind  *string `json:"kind"`
+		Color *string `json:"color"`
+		Icon  *string `json:"icon"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&updatedCategoryRequest)
+	if err != nil {
+		h.logger.Printf("Error: decodingHandleUpdateCategory: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "failed to decode request body"})
+		return
+	}
+
+	if updatedCategoryRequest.Name != nil {
+		category.Name = strings.ToLower(strings.TrimSpace(*updatedCategoryRequest.Name))
+		if category.Name == "" || strings.Contains(category.Name, "/") {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "name is required and must not contain '/'"})
+			return
+		}
+	}
+	if updatedCategoryRequest.Kind != nil {
+		if !validCategoryKind(*updatedCategoryRequest.Kind) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "kind must be expense, income or both"})
+			return
+		}
+		// narrowing the kind must not strand what is already booked on it
+		if *updatedCategoryRequest.Kind != category.Kind && *updatedCategoryRequest.Kind != "both" {
+			excluded := "income"
+			if *updatedCategoryRequest.Kind == "income" {
+				excluded = "expense"
+			}
+			used, err := h.categoryStore.CategoryUsedFor(id, excluded)
+			if err != nil {
+				h.logger.Printf("Error: HandleUpdateCategory: %v", err)
+				utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to update category"})
+				return
+			}
+			if used {
+				utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": fmt.Sprintf("category is still used for %ss, move those first or keep kind both", excluded)})
+				return
+			}
+		}
+		category.Kind = *updatedCategoryRequest.Kind
+	}
+	color, icon, err := readStyle(updatedCategoryRequest.Color, updatedCategoryRequest.Icon)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if updatedCategoryRequest.Color != nil {
+		category.Color = color
+	}
+	if updatedCategoryRequest.Icon != nil {
+		category.Icon = icon
+	}
+
+	err = h.categoryStore.UpdateCategory(category)
+	if errors.Is(err, store.ErrCategoryExists) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleUpdateCategory: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to update category"})
+		return
+	}
+
+	category, err = h.categoryStore.GetCategoryByID(id)
+	if err != nil {
+		h.logger.Printf("Error: HandleUpdateCategory: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting category"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"category": category})
+}
+
+// mergeInto checks that targetID is another category of the user whose kind
+// allows everything booked on category id, and moves all of it there.
+func (h *CategoryHandler) mergeInto(w http.ResponseWriter, handler string, id int64, targetID int64, userID int64) bool {
+	if targetID == id {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "cannot merge a category into itself"})
+		return false
+	}
+	target, err := h.categoryStore.GetCategoryByID(targetID)
+	if err == sql.ErrNoRows || (err == nil && target.UserID != userID) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "target category not found"})
+		return false
+	}
+	if err != nil {
+		h.logger.Printf("Error: %s: %v", handler, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting category"})
+		return false
+	}
+	for _, _type := range []string{"expense", "income"} {
+		if target.Allows(_type) {
+			continue
+		}
+		used, err := h.categoryStore.CategoryUsedFor(id, _type)
+		if err != nil {
+			h.logger.Printf("Error: %s: %v", handler, err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to merge category"})
+			return false
+		}
+		if used {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": fmt.Sprintf("category %q is for %ss only and cannot take the %ss of this category", target.Path, target.Kind, _type)})
+			return false
+		}
+	}
+
+	err = h.categoryStore.MergeCategory(id, targetID)
+	if errors.Is(err, store.ErrCategoryCycle) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "cannot merge a category into one of its subcategories"})
+		return false
+	}
+	if errors.Is(err, store.ErrCategoryExists) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "both categories have a subcategory with the same name, merge those first"})
+		return false
+	}
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "category not found"})
+		return false
+	}
+	if err != nil {
+		h.logger.Printf("Error: %s: %v", handler, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to merge category"})
+		return false
+	}
+	h.classifier.Invalidate(userID)
+	return true
+}
+
+// HandleMergeCategory moves all transactions, rules, budgets and
+// subcategories of a category into target_id and deletes it.
+func (h *CategoryHandler) HandleMergeCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleMergeCategory: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	category, err := h.categoryStore.GetCategoryByID(id)
+	if err != nil {
+		h.logger.Printf("Error: HandleMergeCategory: %v", err)
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "category not found"})
+		return
+	}
+	if category.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+
+	var mergeCategoryRequest struct {
+		TargetID *int64 `json:"target_id"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&mergeCategoryRequest)
+	if err != nil {
+		h.logger.Printf("Error: decodingHandleMergeCategory: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "failed to decode request body"})
+		return
+	}
+	if mergeCategoryRequest.TargetID == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "target_id is required"})
+		return
+	}
+
+	if !h.mergeInto(w, "HandleMergeCategory", id, *mergeCategoryRequest.TargetID, currentUser.ID) {
+		return
+	}
+
+	target, err := h.categoryStore.GetCategoryByID(*mergeCategoryRequest.TargetID)
+	if err != nil {
+		h.logger.Printf("Error: HandleMergeCategory: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting category"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"category": target})
+}
+
+// HandleDeleteCategory deletes an unused category. A category that still
+// has transactions, rules, budgets or subcategories needs ?reassign_to=ID,
+// which merges it into that category instead.
+func (h *CategoryHandler) HandleDeleteCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteCategory: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	category, err := h.categoryStore.GetCategoryByID(id)
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteCategory: %v", err)
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "category not found"})
+		return
+	}
+	if category.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+
+	if reassignStr := r.URL.Query().Get("reassign_to"); reassignStr != "" {
+		reassignTo, err := strconv.ParseInt(reassignStr, 10, 64)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid reassign_to parameter"})
+			return
+		}
+		if !h.mergeInto(w, "HandleDeleteCategory", id, reassignTo, currentUser.ID) {
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status": "category deleted"})
+		return
+	}
+
+	err = h.categoryStore.DeleteCategoryByID(id)
+	if errors.Is(err, store.ErrCategoryInUse) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error() + ", pass reassign_to"})
+		return
+	}
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "category not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteCategory: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error deleting category"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status": "category deleted"})
+}
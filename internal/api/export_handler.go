@@ -0,0 +1,85 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/KartikSindura/money/internal/export"
+	"github.com/KartikSindura/money/internal/middleware"
+	"github.com/KartikSindura/money/internal/store"
+	"github.com/KartikSindura/money/utils"
+)
+
+// exportWriteTimeout replaces the server's WriteTimeout for exports, which
+// can take longer than any other response to stream.
+const exportWriteTimeout = 10 * time.Minute
+
+// HandleExport streams every matching expense, income and transfer of the
+// current user as csv (the default), json or ledger. It takes the same
+// filters as GET /transactions.
+func (h *TransactionHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if !slices.Contains(export.Formats, format) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "format must be csv, json or ledger"})
+		return
+	}
+
+	filter, err := h.readTransactionFilter(r, currentUser.ID)
+	if err != nil {
+		h.writeFilterError(w, "HandleExport", err)
+		return
+	}
+
+	categories, err := h.categoryStore.GetCategories(currentUser.ID, "")
+	if err != nil {
+		h.logger.Printf("Error: HandleExport: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting categories"})
+		return
+	}
+	accounts, err := h.accountStore.GetAccounts(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("Error: HandleExport: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting accounts"})
+		return
+	}
+
+	err = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	if err != nil {
+		h.logger.Printf("Error: HandleExport: %v", err)
+	}
+
+	contentType, extension := export.ContentType(format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="money-export.%s"`, extension))
+
+	writer, err := export.New(format, w, categories, accounts)
+	if err != nil {
+		h.logger.Printf("Error: HandleExport: %v", err)
+		return
+	}
+
+	// the status is sent with the first bytes, so errors from here on can
+	// only be logged and the client sees a truncated file
+	err = h.transactionStore.StreamTransactions(currentUser.ID, *filter, func(transaction *store.Transaction) error {
+		return writer.Write(transaction)
+	})
+	if err != nil {
+		h.logger.Printf("Error: HandleExport: %v", err)
+		return
+	}
+	err = writer.Close()
+	if err != nil {
+		h.logger.Printf("Error: HandleExport: %v", err)
+	}
+}
@@ -0,0 +1,319 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/KartikSindura/money/internal/importer"
+	"github.com/KartikSindura/money/internal/middleware"
+	"github.com/KartikSindura/money/internal/rules"
+	"github.com/KartikSindura/money/internal/store"
+	"github.com/KartikSindura/money/utils"
+)
+
+const maxImportSize = 10 << 20 // 10 MB
+
+// importOptions are the form fields shared by all statement uploads.
+type importOptions struct {
+	currency    string
+	accountID   *int64
+	commit      bool
+	skipInvalid bool
+}
+
+// readImportOptions reads currency, account_id, commit and skip_invalid
+// from the multipart form and checks the account like a single transaction.
+func (h *TransactionHandler) readImportOptions(r *http.Request, currentUser *store.User) (*importOptions, error) {
+	options := &importOptions{
+		currency:    r.FormValue("currency"),
+		commit:      r.FormValue("commit") == "true",
+		skipInvalid: r.FormValue("skip_invalid") == "true",
+	}
+
+	if accountStr := r.FormValue("account_id"); accountStr != "" {
+		accountID, err := strconv.ParseInt(accountStr, 10, 64)
+		if err != nil {
+			return nil, errAccountNotFound
+		}
+		err = h.checkAccount(accountID, currentUser.ID, &options.currency)
+		if err != nil {
+			return nil, err
+		}
+		options.accountID = &accountID
+	}
+
+	// if currency is not provided, use the user's base currency
+	if options.currency == "" {
+		options.currency = currentUser.BaseCurrency
+	}
+	currency, err := store.NormalizeCurrency(options.currency)
+	if err != nil {
+		return nil, err
+	}
+	options.currency = currency
+	return options, nil
+}
+
+// HandleImportCSV parses an uploaded CSV statement with the given column
+// mapping. Without commit=true it only returns the parsed rows so the
+// mapping can be checked; with it the valid rows are booked in one go.
+func (h *TransactionHandler) HandleImportCSV(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	err := r.ParseMultipartForm(maxImportSize)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "expected a multipart form of at most 10 MB"})
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "file is required"})
+		return
+	}
+	defer file.Close()
+
+	var mapping importer.CSVMapping
+	err = json.Unmarshal([]byte(r.FormValue("mapping")), &mapping)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "mapping must be a JSON object"})
+		return
+	}
+	err = mapping.Validate()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	options, err := h.readImportOptions(r, currentUser)
+	if err != nil {
+		h.writeAccountError(w, "HandleImportCSV", err)
+		return
+	}
+
+	rows, err := importer.ParseCSV(file, mapping)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	h.importRows(w, "HandleImportCSV", currentUser, options, rows)
+}
+
+// importRows answers with a preview, or books the rows when the upload asked
+// for a commit. Rows with errors block the commit unless skip_invalid=true.
+func (h *TransactionHandler) importRows(w http.ResponseWriter, handler string, currentUser *store.User, options *importOptions, rows []importer.Row) {
+	err := h.markDuplicates(currentUser.ID, rows)
+	if err != nil {
+		h.logger.Printf("Error: %s: %v", handler, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error checking for imported transactions"})
+		return
+	}
+
+	summary := importer.Summarize(rows)
+	if !options.commit {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"rows": rows, "summary": summary, "committed": false})
+		return
+	}
+	if summary.Invalid > 0 && !options.skipInvalid {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "some rows are invalid, fix them or set skip_invalid=true", "rows": rows, "summary": summary})
+		return
+	}
+
+	userRules, err := h.ruleStore.GetRules(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("Error: %s: %v", handler, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error applying rules"})
+		return
+	}
+
+	// categories and payees are resolved by name when the rows are stored,
+	// in the same transaction
+	expenses := []*store.Expense{}
+	incomes := []*store.Income{}
+	for _, row := range rows {
+		if !row.Valid() || row.Duplicate {
+			continue
+		}
+		var externalID *string
+		if row.ExternalID != "" {
+			externalID = &row.ExternalID
+		}
+
+		// statements carry no payee, so rules can only fill in a payee and a
+		// missing category
+		result := rules.Apply(userRules, rules.Transaction{Type: row.Type, Note: row.Description, Amount: row.Amount, AccountID: options.accountID})
+		if row.Category == "" && result.Category != nil {
+			row.Category = *result.Category
+		}
+		// without a category the row is uncategorized
+		var category *string
+		if row.Category != "" {
+			category = &row.Category
+		}
+		tags := store.NormalizeTags(result.Tags)
+
+		if row.Type == "expense" {
+			expenses = append(expenses, &store.Expense{
+				UserID:     currentUser.ID,
+				Amount:     row.Amount,
+				Currency:   options.currency,
+				AccountID:  options.accountID,
+				Category:   category,
+				Payee:      result.Payee,
+				Note:       row.Description,
+				Date:       row.Date,
+				ExternalID: externalID,
+				Tags:       tags,
+			})
+		} else {
+			incomes = append(incomes, &store.Income{
+				UserID:     currentUser.ID,
+				Amount:     row.Amount,
+				Currency:   options.currency,
+				AccountID:  options.accountID,
+				Category:   category,
+				Payer:      result.Payee,
+				Source:     row.Description,
+				Note:       row.Description,
+				Date:       row.Date,
+				ExternalID: externalID,
+				Tags:       tags,
+			})
+		}
+	}
+
+	// rows imported by a concurrent upload since the check above are skipped too
+	skipped, err := h.transactionStore.ImportTransactions(expenses, incomes)
+	var kindErr *store.CategoryKindError
+	if errors.As(err, &kindErr) {
+		writeCategoryKindError(w, kindErr.Category)
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: %s: %v", handler, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error importing transactions"})
+		return
+	}
+	summary.Duplicates += skipped
+	if len(expenses) > 0 {
+		h.classifier.Invalidate(currentUser.ID)
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"rows":      rows,
+		"summary":   summary,
+		"committed": true,
+		"imported":  len(expenses) + len(incomes) - skipped,
+	})
+}
+
+// markDuplicates flags rows whose external id was imported before or that
+// repeat an earlier row of the same file.
+func (h *TransactionHandler) markDuplicates(userID int64, rows []importer.Row) error {
+	externalIDs := []string{}
+	for _, row := range rows {
+		if row.ExternalID != "" {
+			externalIDs = append(externalIDs, row.ExternalID)
+		}
+	}
+	imported, err := h.transactionStore.GetImportedExternalIDs(userID, externalIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range rows {
+		externalID := rows[i].ExternalID
+		if externalID == "" || !rows[i].Valid() {
+			continue
+		}
+		rows[i].Duplicate = imported[externalID]
+		imported[externalID] = true
+	}
+	return nil
+}
+
+// HandleImportStatement imports OFX/QFX and QIF downloads. The format is
+// taken from the format field, or guessed from the file name and contents.
+// QIF dates are read month first unless date_format says otherwise.
+func (h *TransactionHandler) HandleImportStatement(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	err := r.ParseMultipartForm(maxImportSize)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "expected a multipart form of at most 10 MB"})
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "file is required"})
+		return
+	}
+	defer file.Close()
+
+	options, err := h.readImportOptions(r, currentUser)
+	if err != nil {
+		h.writeAccountError(w, "HandleImportStatement", err)
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "error reading file"})
+		return
+	}
+
+	format := strings.ToLower(r.FormValue("format"))
+	if format == "" {
+		format = guessStatementFormat(header.Filename, data)
+	}
+
+	var rows []importer.Row
+	switch format {
+	case "ofx", "qfx":
+		rows, err = importer.ParseOFX(bytes.NewReader(data))
+	case "qif":
+		rows, err = importer.ParseQIF(bytes.NewReader(data), r.FormValue("date_format"))
+	default:
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "format must be ofx, qfx or qif"})
+		return
+	}
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	h.importRows(w, "HandleImportStatement", currentUser, options, rows)
+}
+
+func guessStatementFormat(filename string, data []byte) string {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".ofx", ".qfx":
+		return "ofx"
+	case ".qif":
+		return "qif"
+	}
+	if bytes.Contains(bytes.ToUpper(data), []byte("<OFX>")) {
+		return "ofx"
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("!")) {
+		return "qif"
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/KartikSindura/money/internal/middleware"
+	"github.com/KartikSindura/money/internal/store"
+	"github.com/KartikSindura/money/utils"
+)
+
+type PayeeHandler struct {
+	payeeStore store.PayeeStore
+	logger     *log.Logger
+}
+
+func NewPayeeHandler(payeeStore store.PayeeStore, logger *log.Logger) *PayeeHandler {
+	return &PayeeHandler{
+		payeeStore: payeeStore,
+		logger:     logger,
+	}
+}
+
+// HandleGetPayees lists the user's payees. Payees are created by naming them
+// on an expense or income.
+func (h *PayeeHandler) HandleGetPayees(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	payees, err := h.payeeStore.GetPayees(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetPayees: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting payees"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"payees": payees})
+}
+
+// HandleGetPayeeSummary totals what was spent at and received from a payee,
+// over all time or between the optional from and to dates.
+func (h *PayeeHandler) HandleGetPayeeSummary(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetPayeeSummary: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	payee, err := h.payeeStore.GetPayeeByID(id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "payee not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleGetPayeeSummary: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting payee"})
+		return
+	}
+	if payee.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+
+	from, err := readDate(r, "from")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	to, err := readDate(r, "to")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if from != nil && to != nil && to.Before(*from) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "from must not be after to"})
+		return
+	}
+
+	summary, err := h.payeeStore.GetPayeeSummary(id, from, to)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetPayeeSummary: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting payee summary"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"summary": summary})
+}
@@ -0,0 +1,377 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KartikSindura/money/internal/middleware"
+	"github.com/KartikSindura/money/internal/store"
+	"github.com/KartikSindura/money/utils"
+)
+
+type RecurringHandler struct {
+	recurringStore store.RecurringStore
+	categoryStore  store.CategoryStore
+	accountStore   store.AccountStore
+	logger         *log.Logger
+}
+
+func NewRecurringHandler(recurringStore store.RecurringStore, categoryStore store.CategoryStore, accountStore store.AccountStore, logger *log.Logger) *RecurringHandler {
+	return &RecurringHandler{
+		recurringStore: recurringStore,
+		categoryStore:  categoryStore,
+		accountStore:   accountStore,
+		logger:         logger,
+	}
+}
+
+func (h *RecurringHandler) validateRecurringRule(rule *store.RecurringRule) error {
+	if rule.Type != "expense" && rule.Type != "income" {
+		return errors.New("type must be expense or income")
+	}
+	if rule.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+	switch rule.Frequency {
+	case "daily", "weekly", "monthly", "yearly":
+	default:
+		return errors.New("frequency must be daily, weekly, monthly or yearly")
+	}
+	if rule.Interval < 1 {
+		return errors.New("interval must be at least 1")
+	}
+	if rule.EndDate != nil && rule.EndDate.Before(*rule.StartDate) {
+		return errors.New("end_date must not be before start_date")
+	}
+	if rule.Count != nil && *rule.Count < 1 {
+		return errors.New("count must be at least 1")
+	}
+	return nil
+}
+
+// materialize posts anything that is already due so a rule starting today
+// does not wait for the next worker tick. Failures are left to the worker.
+func (h *RecurringHandler) materialize(rule *store.RecurringRule) *store.RecurringRule {
+	_, err := h.recurringStore.MaterializeRecurringRule(rule.ID, time.Now())
+	if err != nil {
+		h.logger.Printf("Error: materializing recurring rule %d: %v", rule.ID, err)
+		return rule
+	}
+	refreshed, err := h.recurringStore.GetRecurringRuleByID(rule.ID)
+	if err != nil {
+		h.logger.Printf("Error: materializing recurring rule %d: %v", rule.ID, err)
+		return rule
+	}
+	refreshed.Category = rule.Category
+	return refreshed
+}
+
+func (h *RecurringHandler) HandleCreateRecurringRule(w http.ResponseWriter, r *http.Request) {
+	rule := &store.RecurringRule{}
+	err := json.NewDecoder(r.Body).Decode(&rule)
+	if err != nil {
+		h.logger.Printf("Error: decodingHandleCreateRecurringRule: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "error decoding recurring rule"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+	rule.UserID = currentUser.ID
+	rule.Occurrences = 0
+
+	if rule.AccountID != nil {
+		err = checkUserAccount(h.accountStore, *rule.AccountID, currentUser.ID, &rule.Currency)
+		if err != nil {
+			writeUserAccountError(w, h.logger, "HandleCreateRecurringRule", err)
+			return
+		}
+	}
+
+	// if currency is not provided, use the user's base currency
+	if rule.Currency == "" {
+		rule.Currency = currentUser.BaseCurrency
+	}
+	rule.Currency, err = store.NormalizeCurrency(rule.Currency)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if rule.Interval == 0 {
+		rule.Interval = 1
+	}
+	// if start date is not provided, start now
+	if rule.StartDate == nil {
+		now := time.Now()
+		rule.StartDate = &now
+	}
+
+	err = h.validateRecurringRule(rule)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	category := &store.Category{UserID: currentUser.ID, Name: "uncategorized"}
+	if rule.Category != nil {
+		category.Name = strings.ToLower(*rule.Category)
+		category.Kind = rule.Type
+	}
+	category, err = h.categoryStore.FindOrCreateCategoryByName(category)
+	if err != nil {
+		h.logger.Printf("Error: HandleCreateRecurringRule: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting category"})
+		return
+	}
+	if !category.Allows(rule.Type) {
+		writeCategoryKindError(w, category)
+		return
+	}
+	rule.CategoryID = category.ID
+	rule.Category = &category.Path
+
+	rule, err = h.recurringStore.CreateRecurringRule(rule)
+	if err != nil {
+		h.logger.Printf("Error: HandleCreateRecurringRule: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error creating recurring rule"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"recurring_rule": h.materialize(rule)})
+}
+
+func (h *RecurringHandler) HandleGetRecurringRuleByID(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetRecurringRuleByID: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	rule, err := h.recurringStore.GetRecurringRuleByID(id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "recurring rule not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleGetRecurringRuleByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting recurring rule"})
+		return
+	}
+
+	if rule.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"recurring_rule": rule})
+}
+
+func (h *RecurringHandler) HandleGetRecurringRules(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	rules, err := h.recurringStore.GetRecurringRules(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetRecurringRules: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting recurring rules"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"recurring_rules": rules})
+}
+
+func (h *RecurringHandler) HandleUpdateRecurringRule(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleUpdateRecurringRule: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	existingRule, err := h.recurringStore.GetRecurringRuleByID(id)
+	if err != nil {
+		h.logger.Printf("Error: HandleUpdateRecurringRule: %v", err)
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "cannot find recurring rule"})
+		return
+	}
+
+	if existingRule.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+
+	var updatedRuleRequest struct {
+		Amount    *store.Money `json:"amount"`
+		Currency  *string      `json:"currency"`
+		Category  *string      `json:"category"`
+		Source    *string      `json:"source"`
+		Note      *string      `json:"note"`
+		Frequency *string      `json:"frequency"`
+		Interval  *int         `json:"interval"`
+		StartDate *time.Time   `json:"start_date"`
+		// kept unless given; an explicit null clears them
+		AccountID json.RawMessage `json:"account_id"`
+		EndDate   json.RawMessage `json:"end_date"`
+		Count     json.RawMessage `json:"count"`
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&updatedRuleRequest)
+	if err != nil {
+		h.logger.Printf("Error: decodingHandleUpdateRecurringRule: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "failed to decode request body"})
+		return
+	}
+
+	if updatedRuleRequest.Amount != nil {
+		existingRule.Amount = *updatedRuleRequest.Amount
+	}
+	if updatedRuleRequest.Currency != nil {
+		existingRule.Currency, err = store.NormalizeCurrency(*updatedRuleRequest.Currency)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+	}
+	if updatedRuleRequest.AccountID != nil {
+		existingRule.AccountID = nil
+		err = json.Unmarshal(updatedRuleRequest.AccountID, &existingRule.AccountID)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid account_id"})
+			return
+		}
+	}
+	if existingRule.AccountID != nil {
+		err = checkUserAccount(h.accountStore, *existingRule.AccountID, currentUser.ID, &existingRule.Currency)
+		if err != nil {
+			writeUserAccountError(w, h.logger, "HandleUpdateRecurringRule", err)
+			return
+		}
+	}
+	if updatedRuleRequest.Source != nil {
+		existingRule.Source = *updatedRuleRequest.Source
+	}
+	if updatedRuleRequest.Note != nil {
+		existingRule.Note = *updatedRuleRequest.Note
+	}
+	if updatedRuleRequest.Frequency != nil {
+		existingRule.Frequency = *updatedRuleRequest.Frequency
+	}
+	if updatedRuleRequest.Interval != nil {
+		existingRule.Interval = *updatedRuleRequest.Interval
+	}
+	if updatedRuleRequest.StartDate != nil {
+		existingRule.StartDate = updatedRuleRequest.StartDate
+	}
+	if updatedRuleRequest.EndDate != nil {
+		err = json.Unmarshal(updatedRuleRequest.EndDate, &existingRule.EndDate)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid end_date"})
+			return
+		}
+	}
+	if updatedRuleRequest.Count != nil {
+		err = json.Unmarshal(updatedRuleRequest.Count, &existingRule.Count)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid count"})
+			return
+		}
+	}
+
+	err = h.validateRecurringRule(existingRule)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if updatedRuleRequest.Category != nil {
+		category := &store.Category{
+			UserID: currentUser.ID,
+			Name:   strings.ToLower(*updatedRuleRequest.Category),
+			Kind:   existingRule.Type,
+		}
+		category, err = h.categoryStore.FindOrCreateCategoryByName(category)
+		if err != nil {
+			h.logger.Printf("Error: HandleUpdateRecurringRule: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting category"})
+			return
+		}
+		if !category.Allows(existingRule.Type) {
+			writeCategoryKindError(w, category)
+			return
+		}
+		existingRule.CategoryID = category.ID
+		existingRule.Category = &category.Path
+	}
+	existingRule.UpdatedAt = time.Now()
+
+	err = h.recurringStore.UpdateRecurringRule(existingRule)
+	if err != nil {
+		h.logger.Printf("Error: HandleUpdateRecurringRule: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to update recurring rule"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"recurring_rule": h.materialize(existingRule)})
+}
+
+func (h *RecurringHandler) HandleDeleteRecurringRule(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteRecurringRule: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	rule, err := h.recurringStore.GetRecurringRuleByID(id)
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteRecurringRule: %v", err)
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "recurring rule not found"})
+		return
+	}
+	if rule.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+
+	// transactions that were already posted are kept, only the schedule is removed
+	err = h.recurringStore.DeleteRecurringRuleByID(id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "recurring rule not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteRecurringRule: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error deleting recurring rule"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status": "recurring rule deleted"})
+}
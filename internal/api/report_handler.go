@@ -0,0 +1,215 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KartikSindura/money/internal/middleware"
+	"github.com/KartikSindura/money/internal/store"
+	"github.com/KartikSindura/money/utils"
+)
+
+// maxReportBuckets keeps a typo in from/to from generating millions of rows.
+const maxReportBuckets = 600
+
+type ReportHandler struct {
+	reportStore   store.ReportStore
+	categoryStore store.CategoryStore
+	logger        *log.Logger
+}
+
+func NewReportHandler(reportStore store.ReportStore, categoryStore store.CategoryStore, logger *log.Logger) *ReportHandler {
+	return &ReportHandler{
+		reportStore:   reportStore,
+		categoryStore: categoryStore,
+		logger:        logger,
+	}
+}
+
+// readDate parses an optional YYYY-MM-DD query parameter.
+func readDate(r *http.Request, name string) (*time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, errors.New(name + " must be in YYYY-MM-DD format")
+	}
+	return &date, nil
+}
+
+// readDateRange reads an inclusive from/to range, falling back to the
+// given defaults for missing ends.
+func readDateRange(r *http.Request, fromName string, toName string, defaultFrom time.Time, defaultTo time.Time) (time.Time, time.Time, error) {
+	from, err := readDate(r, fromName)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := readDate(r, toName)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if from == nil {
+		from = &defaultFrom
+	}
+	if to == nil {
+		to = &defaultTo
+	}
+	if to.Before(*from) {
+		return time.Time{}, time.Time{}, errors.New(fromName + " must not be after " + toName)
+	}
+	return *from, *to, nil
+}
+
+// HandleGetSummaryReport returns income, expense, net savings and savings
+// rate per month or year. Without from/to it covers the last 12 months or
+// the last 5 years up to today.
+func (h *ReportHandler) HandleGetSummaryReport(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "month"
+	}
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	var defaultFrom time.Time
+	switch period {
+	case "month":
+		defaultFrom = time.Date(today.Year(), today.Month()-11, 1, 0, 0, 0, 0, time.UTC)
+	case "year":
+		defaultFrom = time.Date(today.Year()-4, time.January, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "period must be month or year"})
+		return
+	}
+
+	from, to, err := readDateRange(r, "from", "to", defaultFrom, today)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	buckets := to.Year() - from.Year() + 1
+	if period == "month" {
+		buckets = (to.Year()-from.Year())*12 + int(to.Month()-from.Month()) + 1
+	}
+	if buckets > maxReportBuckets {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "date range is too long for this period"})
+		return
+	}
+
+	report, err := h.reportStore.GetSummaryReport(currentUser.ID, period, from, to)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetSummaryReport: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting summary report"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"report": report})
+}
+
+// HandleGetCategoryReport breaks expenses (or incomes with type=income) down
+// by category. Without from/to it covers the current month. Passing both
+// compare_from and compare_to adds the change against that window.
+// category=food limits the report to food and its subcategories, and
+// rollup=true adds subcategories into their parents.
+func (h *ReportHandler) HandleGetCategoryReport(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	_type := r.URL.Query().Get("type")
+	if _type == "" {
+		_type = "expense"
+	}
+	if _type != "expense" && _type != "income" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "type must be expense or income"})
+		return
+	}
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	from, to, err := readDateRange(r, "from", "to", monthStart, today)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	var compareFrom, compareTo *time.Time
+	query := r.URL.Query()
+	if query.Get("compare_from") != "" || query.Get("compare_to") != "" {
+		if query.Get("compare_from") == "" || query.Get("compare_to") == "" {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "compare_from and compare_to must be given together"})
+			return
+		}
+		start, end, err := readDateRange(r, "compare_from", "compare_to", time.Time{}, time.Time{})
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		compareFrom, compareTo = &start, &end
+	}
+
+	var parentID *int64
+	if categoryName := query.Get("category"); categoryName != "" {
+		categoryName = strings.ToLower(categoryName)
+		parentID, err = h.categoryStore.GetCategoryIDByName(&categoryName, currentUser.ID)
+		if err == sql.ErrNoRows {
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "category not found"})
+			return
+		}
+		if err != nil {
+			h.logger.Printf("Error: HandleGetCategoryReport: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "fetching category_id by name failed"})
+			return
+		}
+	}
+	rollup := query.Get("rollup") == "true"
+
+	report, err := h.reportStore.GetCategoryReport(currentUser.ID, _type, from, to, compareFrom, compareTo, parentID, rollup)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetCategoryReport: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting category report"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"report": report})
+}
+
+// HandleGetTagReport totals incomes and expenses per tag. Without from/to it
+// covers the current year.
+func (h *ReportHandler) HandleGetTagReport(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	from, to, err := readDateRange(r, "from", "to", time.Date(today.Year(), time.January, 1, 0, 0, 0, 0, time.UTC), today)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	report, err := h.reportStore.GetTagReport(currentUser.ID, from, to)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetTagReport: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting tag report"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"report": report})
+}
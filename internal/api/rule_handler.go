@@ -0,0 +1,450 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/KartikSindura/money/internal/classifier"
+	"github.com/KartikSindura/money/internal/middleware"
+	"github.com/KartikSindura/money/internal/rules"
+	"github.com/KartikSindura/money/internal/store"
+	"github.com/KartikSindura/money/utils"
+)
+
+type RuleHandler struct {
+	ruleStore        store.RuleStore
+	transactionStore store.TransactionStore
+	categoryStore    store.CategoryStore
+	accountStore     store.AccountStore
+	payeeStore       store.PayeeStore
+	classifier       *classifier.Classifier
+	logger           *log.Logger
+}
+
+func NewRuleHandler(ruleStore store.RuleStore, transactionStore store.TransactionStore, categoryStore store.CategoryStore, accountStore store.AccountStore, payeeStore store.PayeeStore, classifier *classifier.Classifier, logger *log.Logger) *RuleHandler {
+	return &RuleHandler{
+		ruleStore:        ruleStore,
+		transactionStore: transactionStore,
+		categoryStore:    categoryStore,
+		accountStore:     accountStore,
+		payeeStore:       payeeStore,
+		classifier:       classifier,
+		logger:           logger,
+	}
+}
+
+// validateRule checks a rule and tidies its text conditions and actions.
+func validateRule(rule *store.Rule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return errors.New("name is required")
+	}
+
+	c := &rule.Conditions
+	if c.Type != nil && *c.Type != "expense" && *c.Type != "income" {
+		return errors.New("type must be expense or income")
+	}
+	if c.NoteContains != nil && strings.TrimSpace(*c.NoteContains) == "" {
+		c.NoteContains = nil
+	}
+	if c.PayeeContains != nil && strings.TrimSpace(*c.PayeeContains) == "" {
+		c.PayeeContains = nil
+	}
+	if (c.MinAmount != nil && *c.MinAmount < 0) || (c.MaxAmount != nil && *c.MaxAmount < 0) {
+		return errors.New("amounts must not be negative")
+	}
+	if c.MinAmount != nil && c.MaxAmount != nil && *c.MinAmount > *c.MaxAmount {
+		return errors.New("min_amount must not be greater than max_amount")
+	}
+
+	a := &rule.Actions
+	if a.SetPayee != nil {
+		payee := strings.TrimSpace(*a.SetPayee)
+		a.SetPayee = &payee
+		if payee == "" {
+			a.SetPayee = nil
+		}
+	}
+	a.AddTags = store.NormalizeTags(a.AddTags)
+	if a.SetCategory == nil && a.SetPayee == nil && len(a.AddTags) == 0 {
+		return errors.New("a rule needs at least one of set_category, add_tags or set_payee")
+	}
+	// categories have a kind, so the rule has to say which one it is for
+	if a.SetCategory != nil && c.Type == nil {
+		return errors.New("a rule that sets a category must have a type condition")
+	}
+	return nil
+}
+
+// resolveRule validates the rule, checks its account belongs to the user and
+// creates the category it sets, storing the category's full path.
+func (h *RuleHandler) resolveRule(w http.ResponseWriter, handler string, rule *store.Rule) bool {
+	err := validateRule(rule)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return false
+	}
+
+	if rule.Conditions.AccountID != nil {
+		account, err := h.accountStore.GetAccountByID(*rule.Conditions.AccountID)
+		if err == sql.ErrNoRows || (err == nil && account.UserID != rule.UserID) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": errAccountNotFound.Error()})
+			return false
+		}
+		if err != nil {
+			h.logger.Printf("Error: %s: %v", handler, err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting account"})
+			return false
+		}
+	}
+
+	if rule.Actions.SetCategory != nil {
+		category := &store.Category{
+			UserID: rule.UserID,
+			Name:   strings.ToLower(*rule.Actions.SetCategory),
+			Kind:   *rule.Conditions.Type,
+		}
+		category, err = h.categoryStore.FindOrCreateCategoryByName(category)
+		if err != nil {
+			h.logger.Printf("Error: %s: %v", handler, err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting category"})
+			return false
+		}
+		if !category.Allows(*rule.Conditions.Type) {
+			writeCategoryKindError(w, category)
+			return false
+		}
+		rule.Actions.SetCategory = &category.Path
+	}
+	return true
+}
+
+func (h *RuleHandler) HandleCreateRule(w http.ResponseWriter, r *http.Request) {
+	rule := &store.Rule{Enabled: true}
+	err := json.NewDecoder(r.Body).Decode(&rule)
+	if err != nil {
+		h.logger.Printf("Error: decodingHandleCreateRule: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "error decoding rule"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+	rule.UserID = currentUser.ID
+
+	if !h.resolveRule(w, "HandleCreateRule", rule) {
+		return
+	}
+
+	rule, err = h.ruleStore.CreateRule(rule)
+	if err != nil {
+		h.logger.Printf("Error: HandleCreateRule: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error creating rule"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"rule": rule})
+}
+
+func (h *RuleHandler) HandleGetRuleByID(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetRuleByID: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	rule, err := h.ruleStore.GetRuleByID(id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "rule not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleGetRuleByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting rule"})
+		return
+	}
+
+	if rule.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"rule": rule})
+}
+
+// HandleGetRules lists the user's rules in the order they are applied.
+func (h *RuleHandler) HandleGetRules(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	userRules, err := h.ruleStore.GetRules(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetRules: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting rules"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"rules": userRules})
+}
+
+func (h *RuleHandler) HandleUpdateRule(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleUpdateRule: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	existingRule, err := h.ruleStore.GetRuleByID(id)
+	if err != nil {
+		h.logger.Printf("Error: HandleUpdateRule: %v", err)
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "cannot find rule"})
+		return
+	}
+	if existingRule.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+
+	// conditions and actions are replaced as a whole
+	var updatedRuleRequest struct {
+		Name       *string               `json:"name"`
+		Priority   *int                  `json:"priority"`
+		Conditions *store.RuleConditions `json:"conditions"`
+		Actions    *store.RuleActions    `json:"actions"`
+		Enabled    *bool                 `json:"enabled"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&updatedRuleRequest)
+	if err != nil {
+		h.logger.Printf("Error: decodingHandleUpdateRule: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "failed to decode request body"})
+		return
+	}
+
+	if updatedRuleRequest.Name != nil {
+		existingRule.Name = *updatedRuleRequest.Name
+	}
+	if updatedRuleRequest.Priority != nil {
+		existingRule.Priority = *updatedRuleRequest.Priority
+	}
+	if updatedRuleRequest.Conditions != nil {
+		existingRule.Conditions = *updatedRuleRequest.Conditions
+	}
+	if updatedRuleRequest.Actions != nil {
+		existingRule.Actions = *updatedRuleRequest.Actions
+	}
+	if updatedRuleRequest.Enabled != nil {
+		existingRule.Enabled = *updatedRuleRequest.Enabled
+	}
+
+	if !h.resolveRule(w, "HandleUpdateRule", existingRule) {
+		return
+	}
+	existingRule.UpdatedAt = time.Now()
+
+	err = h.ruleStore.UpdateRule(existingRule)
+	if err != nil {
+		h.logger.Printf("Error: HandleUpdateRule: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to update rule"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"rule": existingRule})
+}
+
+func (h *RuleHandler) HandleDeleteRule(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteRule: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	rule, err := h.ruleStore.GetRuleByID(id)
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteRule: %v", err)
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "rule not found"})
+		return
+	}
+	if rule.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+
+	// transactions the rule already changed keep their changes
+	err = h.ruleStore.DeleteRuleByID(id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "rule not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteRule: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error deleting rule"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status": "rule deleted"})
+}
+
+// HandleApplyRules re-runs the rules over all of the user's expenses and
+// incomes. Only uncategorized transactions get a category and only ones
+// without a payee get a payee, unless overwrite is set; tags are always
+// added. With dry_run the changes are returned without saving them.
+func (h *RuleHandler) HandleApplyRules(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	var applyRequest struct {
+		DryRun    bool `json:"dry_run"`
+		Overwrite bool `json:"overwrite"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&applyRequest)
+	if err != nil && err != io.EOF {
+		h.logger.Printf("Error: decodingHandleApplyRules: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "failed to decode request body"})
+		return
+	}
+
+	userRules, err := h.ruleStore.GetRules(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("Error: HandleApplyRules: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting rules"})
+		return
+	}
+	categories, err := h.categoryStore.GetCategories(currentUser.ID, "")
+	if err != nil {
+		h.logger.Printf("Error: HandleApplyRules: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting categories"})
+		return
+	}
+	paths := map[int64]string{}
+	for _, category := range categories {
+		paths[category.ID] = category.Path
+	}
+
+	changes := []store.RuleChange{}
+	err = h.transactionStore.StreamTransactions(currentUser.ID, store.TransactionFilter{}, func(t *store.Transaction) error {
+		if t.Type == "transfer" {
+			return nil
+		}
+		payee := t.Payee
+		if payee == nil && t.Source != nil && *t.Source != "" {
+			payee = t.Source
+		}
+		result := rules.Apply(userRules, rules.Transaction{Type: t.Type, Note: t.Note, Payee: payee, Amount: t.Amount, AccountID: t.AccountID})
+		if len(result.RuleIDs) == 0 {
+			return nil
+		}
+
+		change := store.RuleChange{Type: t.Type, ID: t.ID, Note: t.Note, RuleIDs: result.RuleIDs}
+		current := ""
+		if t.CategoryID != nil {
+			current = paths[*t.CategoryID]
+		}
+		if result.Category != nil && *result.Category != current && (current == "uncategorized" || applyRequest.Overwrite) {
+			change.Category = result.Category
+		}
+		if result.Payee != nil && (t.Payee == nil || (applyRequest.Overwrite && !strings.EqualFold(*t.Payee, *result.Payee))) {
+			change.Payee = result.Payee
+		}
+		for _, tag := range store.NormalizeTags(result.Tags) {
+			if !slices.Contains(t.Tags, tag) {
+				change.AddTags = append(change.AddTags, tag)
+			}
+		}
+
+		if change.Category != nil || change.Payee != nil || len(change.AddTags) > 0 {
+			changes = append(changes, change)
+		}
+		return nil
+	})
+	if err != nil {
+		h.logger.Printf("Error: HandleApplyRules: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting transactions"})
+		return
+	}
+
+	if applyRequest.DryRun {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"changes": changes, "dry_run": true})
+		return
+	}
+
+	categoryIDs := map[string]int64{}
+	payeeIDs := map[string]int64{}
+	for i := range changes {
+		change := &changes[i]
+		if change.Category != nil {
+			key := change.Type + ":" + *change.Category
+			categoryID, ok := categoryIDs[key]
+			if !ok {
+				category, err := h.categoryStore.FindOrCreateCategoryByName(&store.Category{UserID: currentUser.ID, Name: *change.Category, Kind: change.Type})
+				if err != nil {
+					h.logger.Printf("Error: HandleApplyRules: %v", err)
+					utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting category"})
+					return
+				}
+				if !category.Allows(change.Type) {
+					writeCategoryKindError(w, category)
+					return
+				}
+				categoryID = category.ID
+				categoryIDs[key] = categoryID
+			}
+			change.CategoryID = &categoryID
+		}
+		if change.Payee != nil {
+			key := strings.ToLower(*change.Payee)
+			payeeID, ok := payeeIDs[key]
+			if !ok {
+				payee, err := h.payeeStore.FindOrCreatePayeeByName(&store.Payee{UserID: currentUser.ID, Name: *change.Payee})
+				if err != nil {
+					h.logger.Printf("Error: HandleApplyRules: %v", err)
+					utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting payee"})
+					return
+				}
+				payeeID = payee.ID
+				payeeIDs[key] = payeeID
+			}
+			change.PayeeID = &payeeID
+		}
+	}
+
+	err = h.ruleStore.ApplyRuleChanges(currentUser.ID, changes)
+	if err != nil {
+		h.logger.Printf("Error: HandleApplyRules: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error applying rules"})
+		return
+	}
+	h.classifier.Invalidate(currentUser.ID)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"changes": changes, "dry_run": false})
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/KartikSindura/money/internal/middleware"
+	"github.com/KartikSindura/money/internal/store"
+	"github.com/KartikSindura/money/utils"
+)
+
+type SessionHandler struct {
+	sessionStore store.SessionStore
+	logger       *log.Logger
+}
+
+func NewSessionHandler(sessionStore store.SessionStore, logger *log.Logger) *SessionHandler {
+	return &SessionHandler{
+		sessionStore: sessionStore,
+		logger:       logger,
+	}
+}
+
+// HandleGetSessions lists where the user is logged in, marking the session
+// the request was made with.
+func (h *SessionHandler) HandleGetSessions(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	sessions, err := h.sessionStore.GetSessions(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetSessions: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting sessions"})
+		return
+	}
+	currentSessionID := middleware.GetSessionID(r)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"sessions": sessions})
+}
+
+// HandleDeleteSession logs one device out by revoking its session.
+func (h *SessionHandler) HandleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteSession: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	session, err := h.sessionStore.GetSessionByID(id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "session not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteSession: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting session"})
+		return
+	}
+	if session.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+
+	err = h.sessionStore.RevokeSession(id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "session not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteSession: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error revoking session"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status": "session revoked"})
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/KartikSindura/money/internal/middleware"
+	"github.com/KartikSindura/money/internal/store"
+	"github.com/KartikSindura/money/utils"
+)
+
+type TagHandler struct {
+	tagStore store.TagStore
+	logger   *log.Logger
+}
+
+func NewTagHandler(tagStore store.TagStore, logger *log.Logger) *TagHandler {
+	return &TagHandler{
+		tagStore: tagStore,
+		logger:   logger,
+	}
+}
+
+// HandleGetTags lists the user's tags. Tags are created by using them on an
+// expense or income.
+func (h *TagHandler) HandleGetTags(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	tags, err := h.tagStore.GetTags(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetTags: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting tags"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"tags": tags})
+}
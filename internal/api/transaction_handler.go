@@ -3,12 +3,18 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/KartikSindura/money/internal/classifier"
+	"github.com/KartikSindura/money/internal/duplicates"
 	"github.com/KartikSindura/money/internal/middleware"
+	"github.com/KartikSindura/money/internal/rules"
 	"github.com/KartikSindura/money/internal/store"
 	"github.com/KartikSindura/money/utils"
 )
@@ -16,17 +22,197 @@ import (
 type TransactionHandler struct {
 	transactionStore store.TransactionStore
 	categoryStore    store.CategoryStore
+	accountStore     store.AccountStore
+	payeeStore       store.PayeeStore
+	ruleStore        store.RuleStore
+	classifier       *classifier.Classifier
 	logger           *log.Logger
 }
 
-func NewTransactionHandler(transactionStore store.TransactionStore, categoryStore store.CategoryStore, logger *log.Logger) *TransactionHandler {
+func NewTransactionHandler(transactionStore store.TransactionStore, categoryStore store.CategoryStore, accountStore store.AccountStore, payeeStore store.PayeeStore, ruleStore store.RuleStore, classifier *classifier.Classifier, logger *log.Logger) *TransactionHandler {
 	return &TransactionHandler{
 		transactionStore: transactionStore,
 		categoryStore:    categoryStore,
+		accountStore:     accountStore,
+		payeeStore:       payeeStore,
+		ruleStore:        ruleStore,
+		classifier:       classifier,
 		logger:           logger,
 	}
 }
 
+// applyRules runs the user's rules, in priority order, over a new
+// transaction.
+func (h *TransactionHandler) applyRules(userID int64, t rules.Transaction) (rules.Result, error) {
+	userRules, err := h.ruleStore.GetRules(userID)
+	if err != nil {
+		return rules.Result{}, err
+	}
+	return rules.Apply(userRules, t), nil
+}
+
+// resolvePayee finds the user's payee by name, ignoring case, and creates it
+// on first use. A blank name means no payee.
+func (h *TransactionHandler) resolvePayee(userID int64, name string) (*int64, *string, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, nil, nil
+	}
+	payee, err := h.payeeStore.FindOrCreatePayeeByName(&store.Payee{UserID: userID, Name: name})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &payee.ID, &payee.Name, nil
+}
+
+var (
+	errAccountNotFound = errors.New("account not found")
+	errAccountCurrency = errors.New("currency must match the account currency")
+)
+
+func (h *TransactionHandler) checkAccount(accountID int64, userID int64, currency *string) error {
+	return checkUserAccount(h.accountStore, accountID, userID, currency)
+}
+
+func (h *TransactionHandler) writeAccountError(w http.ResponseWriter, handler string, err error) {
+	writeUserAccountError(w, h.logger, handler, err)
+}
+
+// checkUserAccount makes sure the account belongs to the user. An empty
+// currency is filled in from the account, any other currency must match it.
+func checkUserAccount(accountStore store.AccountStore, accountID int64, userID int64, currency *string) error {
+	account, err := accountStore.GetAccountByID(accountID)
+	if err == sql.ErrNoRows {
+		return errAccountNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if account.UserID != userID {
+		return errAccountNotFound
+	}
+
+	if *currency == "" {
+		*currency = account.Currency
+		return nil
+	}
+	normalized, err := store.NormalizeCurrency(*currency)
+	if err != nil {
+		return err
+	}
+	if normalized != account.Currency {
+		return errAccountCurrency
+	}
+	return nil
+}
+
+func writeUserAccountError(w http.ResponseWriter, logger *log.Logger, handler string, err error) {
+	if errors.Is(err, errAccountNotFound) || errors.Is(err, errAccountCurrency) || errors.Is(err, store.ErrInvalidCurrency) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	logger.Printf("Error: %s: %v", handler, err)
+	utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting account"})
+}
+
+var (
+	errInvalidFilter  = errors.New("error parsing transaction query params")
+	errCategoryFilter = errors.New("category not found")
+)
+
+// readTransactionFilter parses the from/to/month/year/type/category query
+// parameters shared by the transaction listing and the export, and the
+// repeatable tag parameter, matched as any of them or all with tag_match=all.
+func (h *TransactionHandler) readTransactionFilter(r *http.Request, userID int64) (*store.TransactionFilter, error) {
+	from, to, month, year, _type, categoryName, err := utils.GetTransactionQueryParams(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidFilter, err)
+	}
+
+	filter := &store.TransactionFilter{From: from, To: to, Month: month, Year: year, Type: _type}
+	if tags := store.NormalizeTags(r.URL.Query()["tag"]); len(tags) > 0 {
+		filter.Tags = tags
+	}
+	switch r.URL.Query().Get("tag_match") {
+	case "", "any":
+	case "all":
+		filter.AllTags = true
+	default:
+		return nil, fmt.Errorf("%w: tag_match must be any or all", errInvalidFilter)
+	}
+	if categoryName != nil {
+		filter.CategoryID, err = h.categoryStore.GetCategoryIDByName(categoryName, userID)
+		if err == sql.ErrNoRows {
+			return nil, errCategoryFilter
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return filter, nil
+}
+
+func (h *TransactionHandler) writeFilterError(w http.ResponseWriter, handler string, err error) {
+	h.logger.Printf("Error: %s: %v", handler, err)
+	if errors.Is(err, errInvalidFilter) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": errInvalidFilter.Error()})
+		return
+	}
+	if errors.Is(err, errCategoryFilter) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": err.Error()})
+		return
+	}
+	utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "fetching category_id by name failed"})
+}
+
+// writeCategoryKindError rejects a category of the other kind, like
+// "salary" on an expense.
+func writeCategoryKindError(w http.ResponseWriter, category *store.Category) {
+	utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": (&store.CategoryKindError{Category: category}).Error()})
+}
+
+// resolveSplits checks that splits add up to amount and resolves the
+// category of every split, by path like the expense's own category or by
+// category_id.
+func (h *TransactionHandler) resolveSplits(w http.ResponseWriter, handler string, userID int64, amount store.Money, splits store.SplitList) bool {
+	err := store.CheckSplits(amount, splits)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return false
+	}
+
+	for i := range splits {
+		var category *store.Category
+		if splits[i].Category != nil {
+			category, err = h.categoryStore.FindOrCreateCategoryByName(&store.Category{
+				UserID: userID,
+				Name:   strings.ToLower(*splits[i].Category),
+				Kind:   "expense",
+			})
+		} else if splits[i].CategoryID != 0 {
+			category, err = h.categoryStore.GetCategoryByID(splits[i].CategoryID)
+			if err == sql.ErrNoRows || (err == nil && category.UserID != userID) {
+				utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "split category not found"})
+				return false
+			}
+		} else {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "every split needs a category or category_id"})
+			return false
+		}
+		if err != nil {
+			h.logger.Printf("Error: %s: %v", handler, err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting category"})
+			return false
+		}
+		if !category.Allows("expense") {
+			writeCategoryKindError(w, category)
+			return false
+		}
+		splits[i].CategoryID = category.ID
+		splits[i].Category = &category.Path
+	}
+	return true
+}
+
 func (h *TransactionHandler) HandleCreateExpense(w http.ResponseWriter, r *http.Request) {
 	expense := &store.Expense{}
 	err := json.NewDecoder(r.Body).Decode(&expense)
@@ -37,13 +223,12 @@ func (h *TransactionHandler) HandleCreateExpense(w http.ResponseWriter, r *http.
 	}
 
 	// if category is not provided, set it to "Uncategorized"
-	categoryName := "uncategorized"
+	category := &store.Category{Name: "uncategorized"}
 	if expense.Category != nil {
-		categoryName = strings.ToLower(*expense.Category)
+		category.Name = strings.ToLower(*expense.Category)
+		category.Kind = "expense"
 	}
 
-	category := &store.Category{Name: categoryName}
-
 	currentUser := middleware.GetUser(r)
 	if currentUser == nil {
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
@@ -53,6 +238,54 @@ func (h *TransactionHandler) HandleCreateExpense(w http.ResponseWriter, r *http.
 	category.UserID = currentUser.ID
 	expense.UserID = currentUser.ID
 
+	// rules only fill in a category or payee the client left out, but
+	// always add their tags
+	result, err := h.applyRules(currentUser.ID, rules.Transaction{Type: "expense", Note: expense.Note, Payee: expense.Payee, Amount: expense.Amount, AccountID: expense.AccountID})
+	if err != nil {
+		h.logger.Printf("Error: HandleCreateExpense: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error applying rules"})
+		return
+	}
+	if expense.Category == nil && len(expense.Splits) == 0 && result.Category != nil {
+		expense.Category = result.Category
+		category.Name = *result.Category
+		category.Kind = "expense"
+	}
+	if expense.Payee == nil {
+		expense.Payee = result.Payee
+	}
+	expense.Tags = store.NormalizeTags(append(expense.Tags, result.Tags...))
+
+	// payees are only ever picked by name, so a payee_id cannot point at
+	// someone else's payee
+	expense.PayeeID = nil
+	if expense.Payee != nil {
+		expense.PayeeID, expense.Payee, err = h.resolvePayee(currentUser.ID, *expense.Payee)
+		if err != nil {
+			h.logger.Printf("Error: HandleCreateExpense: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting payee"})
+			return
+		}
+	}
+
+	if expense.AccountID != nil {
+		err = h.checkAccount(*expense.AccountID, currentUser.ID, &expense.Currency)
+		if err != nil {
+			h.writeAccountError(w, "HandleCreateExpense", err)
+			return
+		}
+	}
+
+	// if currency is not provided, use the user's base currency
+	if expense.Currency == "" {
+		expense.Currency = currentUser.BaseCurrency
+	}
+	expense.Currency, err = store.NormalizeCurrency(expense.Currency)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
 	// get category id
 	category, err = h.categoryStore.FindOrCreateCategoryByName(category)
 	if err != nil {
@@ -60,24 +293,75 @@ func (h *TransactionHandler) HandleCreateExpense(w http.ResponseWriter, r *http.
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting category"})
 		return
 	}
+	if !category.Allows("expense") {
+		writeCategoryKindError(w, category)
+		return
+	}
 
 	expense.CategoryID = category.ID
 
+	if !h.resolveSplits(w, "HandleCreateExpense", currentUser.ID, expense.Amount, expense.Splits) {
+		return
+	}
+	// a split expense without a category of its own is listed under its first split
+	if expense.Category == nil && len(expense.Splits) > 0 {
+		expense.CategoryID = expense.Splits[0].CategoryID
+	}
+
 	// if date is not provided, set it to now
 	if expense.Date == nil {
 		now := time.Now()
 		expense.Date = &now
 	}
 
+	// reject_duplicates=true refuses an expense that looks like one booked
+	// before, for clients that may send the same one twice
+	if r.URL.Query().Get("reject_duplicates") == "true" {
+		duplicateID, err := h.findDuplicateExpense(expense)
+		if err != nil {
+			h.logger.Printf("Error: HandleCreateExpense: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error checking for duplicates"})
+			return
+		}
+		if duplicateID != nil {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "likely duplicate of an existing expense", "duplicate_id": *duplicateID})
+			return
+		}
+	}
+
 	expense, err = h.transactionStore.CreateExpense(expense)
 	if err != nil {
 		h.logger.Printf("Error: HandleCreateExpense: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error creating expense"})
 		return
 	}
+	h.classifier.Learn(currentUser.ID, classifier.ExampleOf(expense))
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"expense": expense})
 }
 
+// findDuplicateExpense returns the id of an existing expense the new one
+// looks like, if any.
+func (h *TransactionHandler) findDuplicateExpense(expense *store.Expense) (*int64, error) {
+	nearby, err := h.transactionStore.GetExpensesNear(expense.UserID, expense.Amount, expense.Currency, *expense.Date, duplicates.DefaultDays)
+	if err != nil {
+		return nil, err
+	}
+	candidate := &store.Transaction{
+		Type:     "expense",
+		Amount:   expense.Amount,
+		Currency: expense.Currency,
+		Note:     expense.Note,
+		Payee:    expense.Payee,
+		Date:     *expense.Date,
+	}
+	for i := range nearby {
+		if duplicates.Same(candidate, &nearby[i], duplicates.DefaultDays) {
+			return &nearby[i].ID, nil
+		}
+	}
+	return nil, nil
+}
+
 func (h *TransactionHandler) HandleGetExpenseByID(w http.ResponseWriter, r *http.Request) {
 	id, err := utils.ReadIDParam(r)
 	if err != nil {
@@ -138,13 +422,19 @@ func (h *TransactionHandler) HandleUpdateExpense(w http.ResponseWriter, r *http.
 		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "expense not found"})
 		return
 	}
+	learned := classifier.ExampleOf(existingExpense)
 
 	var updatedExpenseRequest struct {
-		Amount     *float64   `json:"amount"`
-		Category   *string    `json:"category"`
-		CategoryID int64      `json:"category_id"`
-		Note       *string    `json:"note"`
-		Date       *time.Time `json:"date"`
+		Amount     *store.Money     `json:"amount"`
+		Currency   *string          `json:"currency"`
+		AccountID  json.RawMessage  `json:"account_id"` // kept unless given; null detaches it
+		Category   *string          `json:"category"`
+		CategoryID int64            `json:"category_id"`
+		Note       *string          `json:"note"`
+		Payee      *string          `json:"payee"`
+		Tags       *[]string        `json:"tags"`
+		Splits     *store.SplitList `json:"splits"`
+		Date       *time.Time       `json:"date"`
 	}
 
 	err = json.NewDecoder(r.Body).Decode(&updatedExpenseRequest)
@@ -164,16 +454,37 @@ func (h *TransactionHandler) HandleUpdateExpense(w http.ResponseWriter, r *http.
 		existingExpense.Amount = *updatedExpenseRequest.Amount
 	}
 
-	var categoryName string
-	if updatedExpenseRequest.Category != nil {
-		categoryName = strings.ToLower(*updatedExpenseRequest.Category)
-	} else {
-		categoryName = "uncategorized"
+	if updatedExpenseRequest.Currency != nil {
+		existingExpense.Currency, err = store.NormalizeCurrency(*updatedExpenseRequest.Currency)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+	}
+
+	if updatedExpenseRequest.AccountID != nil {
+		existingExpense.AccountID = nil
+		err = json.Unmarshal(updatedExpenseRequest.AccountID, &existingExpense.AccountID)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid account_id"})
+			return
+		}
+	}
+	if existingExpense.AccountID != nil {
+		err = h.checkAccount(*existingExpense.AccountID, currentUser.ID, &existingExpense.Currency)
+		if err != nil {
+			h.writeAccountError(w, "HandleUpdateExpense", err)
+			return
+		}
 	}
 
 	category := &store.Category{
 		UserID: currentUser.ID,
-		Name:   categoryName,
+		Name:   "uncategorized",
+	}
+	if updatedExpenseRequest.Category != nil {
+		category.Name = strings.ToLower(*updatedExpenseRequest.Category)
+		category.Kind = "expense"
 	}
 	category, err = h.categoryStore.FindOrCreateCategoryByName(category)
 	if err != nil {
@@ -181,11 +492,43 @@ func (h *TransactionHandler) HandleUpdateExpense(w http.ResponseWriter, r *http.
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting category"})
 		return
 	}
+	if !category.Allows("expense") {
+		writeCategoryKindError(w, category)
+		return
+	}
 	existingExpense.CategoryID = category.ID
 
+	// splits are kept unless given, but must still add up to the new amount;
+	// an empty list removes them
+	if updatedExpenseRequest.Splits != nil {
+		existingExpense.Splits = *updatedExpenseRequest.Splits
+		if !h.resolveSplits(w, "HandleUpdateExpense", currentUser.ID, existingExpense.Amount, existingExpense.Splits) {
+			return
+		}
+	} else if err := store.CheckSplits(existingExpense.Amount, existingExpense.Splits); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if updatedExpenseRequest.Category == nil && len(existingExpense.Splits) > 0 {
+		existingExpense.CategoryID = existingExpense.Splits[0].CategoryID
+	}
+
 	if updatedExpenseRequest.Note != nil {
 		existingExpense.Note = *updatedExpenseRequest.Note
 	}
+	// the payee is kept unless given; an empty name removes it
+	if updatedExpenseRequest.Payee != nil {
+		existingExpense.PayeeID, existingExpense.Payee, err = h.resolvePayee(currentUser.ID, *updatedExpenseRequest.Payee)
+		if err != nil {
+			h.logger.Printf("Error: HandleUpdateExpense: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting payee"})
+			return
+		}
+	}
+	// tags are kept unless given; an empty list removes them
+	if updatedExpenseRequest.Tags != nil {
+		existingExpense.Tags = store.NormalizeTags(*updatedExpenseRequest.Tags)
+	}
 	// if date is not provided, set it to now
 	if updatedExpenseRequest.Date == nil {
 		now := time.Now()
@@ -202,6 +545,8 @@ func (h *TransactionHandler) HandleUpdateExpense(w http.ResponseWriter, r *http.
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update expense"})
 		return
 	}
+	h.classifier.Forget(currentUser.ID, learned)
+	h.classifier.Learn(currentUser.ID, classifier.ExampleOf(existingExpense))
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"expense": existingExpense})
 }
 
@@ -241,6 +586,7 @@ func (h *TransactionHandler) HandleDeleteExpense(w http.ResponseWriter, r *http.
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error deleting expense"})
 		return
 	}
+	h.classifier.Forget(currentUser.ID, classifier.ExampleOf(expense))
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status": "expense deleted"})
 }
 
@@ -273,7 +619,18 @@ func (h *TransactionHandler) HandleGetTotalExpenses(w http.ResponseWriter, r *ht
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting total expenses"})
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"totalExpenses": totalExpenses})
+	if r.URL.Query().Get("convert") != "true" {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"totalExpenses": totalExpenses})
+		return
+	}
+
+	converted, err := h.transactionStore.GetTotalExpensesConverted(currentUser.ID, currentUser.BaseCurrency)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetTotalExpenses: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error converting total expenses"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"totalExpenses": totalExpenses, "converted": converted})
 }
 
 func (h *TransactionHandler) HandleCreateIncome(w http.ResponseWriter, r *http.Request) {
@@ -285,12 +642,12 @@ func (h *TransactionHandler) HandleCreateIncome(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	categoryName := "uncategorized"
-	if income.Category != nil {
-		categoryName = strings.ToLower(*income.Category)
-	}
 	category := &store.Category{
-		Name: categoryName,
+		Name: "uncategorized",
+	}
+	if income.Category != nil {
+		category.Name = strings.ToLower(*income.Category)
+		category.Kind = "income"
 	}
 
 	currentUser := middleware.GetUser(r)
@@ -301,12 +658,68 @@ func (h *TransactionHandler) HandleCreateIncome(w http.ResponseWriter, r *http.R
 	category.UserID = currentUser.ID
 	income.UserID = currentUser.ID
 
+	// the payer defaults to the free-text source and fills it in when missing
+	income.PayerID = nil
+	if income.Payer == nil && income.Source != "" {
+		income.Payer = &income.Source
+	}
+
+	result, err := h.applyRules(currentUser.ID, rules.Transaction{Type: "income", Note: income.Note, Payee: income.Payer, Amount: income.Amount, AccountID: income.AccountID})
+	if err != nil {
+		h.logger.Printf("Error: HandleCreateIncome: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error applying rules"})
+		return
+	}
+	if income.Category == nil && result.Category != nil {
+		income.Category = result.Category
+		category.Name = *result.Category
+		category.Kind = "income"
+	}
+	if income.Payer == nil {
+		income.Payer = result.Payee
+	}
+	income.Tags = store.NormalizeTags(append(income.Tags, result.Tags...))
+
+	if income.Payer != nil {
+		income.PayerID, income.Payer, err = h.resolvePayee(currentUser.ID, *income.Payer)
+		if err != nil {
+			h.logger.Printf("Error: HandleCreateIncome: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting payee"})
+			return
+		}
+	}
+	if income.Source == "" && income.Payer != nil {
+		income.Source = *income.Payer
+	}
+
+	if income.AccountID != nil {
+		err = h.checkAccount(*income.AccountID, currentUser.ID, &income.Currency)
+		if err != nil {
+			h.writeAccountError(w, "HandleCreateIncome", err)
+			return
+		}
+	}
+
+	// if currency is not provided, use the user's base currency
+	if income.Currency == "" {
+		income.Currency = currentUser.BaseCurrency
+	}
+	income.Currency, err = store.NormalizeCurrency(income.Currency)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
 	category, err = h.categoryStore.FindOrCreateCategoryByName(category)
 	if err != nil {
 		h.logger.Printf("Error: HandleCreateIncome: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting category"})
 		return
 	}
+	if !category.Allows("income") {
+		writeCategoryKindError(w, category)
+		return
+	}
 
 	income.CategoryID = category.ID
 
@@ -386,12 +799,16 @@ func (h *TransactionHandler) HandleUpdateIncome(w http.ResponseWriter, r *http.R
 	}
 
 	var updatedIncomeRequest struct {
-		Amount     *float64   `json:"amount"`
-		Category   *string    `json:"category"`
-		CategoryID int64      `json:"category_id"`
-		Note       *string    `json:"note"`
-		Source     *string    `json:"source"`
-		Date       *time.Time `json:"date"`
+		Amount     *store.Money    `json:"amount"`
+		Currency   *string         `json:"currency"`
+		AccountID  json.RawMessage `json:"account_id"` // kept unless given; null detaches it
+		Category   *string         `json:"category"`
+		CategoryID int64           `json:"category_id"`
+		Note       *string         `json:"note"`
+		Source     *string         `json:"source"`
+		Payer      *string         `json:"payer"`
+		Tags       *[]string       `json:"tags"`
+		Date       *time.Time      `json:"date"`
 	}
 
 	err = json.NewDecoder(r.Body).Decode(&updatedIncomeRequest)
@@ -411,16 +828,37 @@ func (h *TransactionHandler) HandleUpdateIncome(w http.ResponseWriter, r *http.R
 		existingIncome.Amount = *updatedIncomeRequest.Amount
 	}
 
-	var categoryName string
-	if updatedIncomeRequest.Category != nil {
-		categoryName = strings.ToLower(*updatedIncomeRequest.Category)
-	} else {
-		categoryName = "uncategorized"
+	if updatedIncomeRequest.Currency != nil {
+		existingIncome.Currency, err = store.NormalizeCurrency(*updatedIncomeRequest.Currency)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+	}
+
+	if updatedIncomeRequest.AccountID != nil {
+		existingIncome.AccountID = nil
+		err = json.Unmarshal(updatedIncomeRequest.AccountID, &existingIncome.AccountID)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid account_id"})
+			return
+		}
+	}
+	if existingIncome.AccountID != nil {
+		err = h.checkAccount(*existingIncome.AccountID, currentUser.ID, &existingIncome.Currency)
+		if err != nil {
+			h.writeAccountError(w, "HandleUpdateIncome", err)
+			return
+		}
 	}
 
 	category := &store.Category{
 		UserID: currentUser.ID,
-		Name:   categoryName,
+		Name:   "uncategorized",
+	}
+	if updatedIncomeRequest.Category != nil {
+		category.Name = strings.ToLower(*updatedIncomeRequest.Category)
+		category.Kind = "income"
 	}
 	category, err = h.categoryStore.FindOrCreateCategoryByName(category)
 	if err != nil {
@@ -428,15 +866,32 @@ func (h *TransactionHandler) HandleUpdateIncome(w http.ResponseWriter, r *http.R
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting category"})
 		return
 	}
+	if !category.Allows("income") {
+		writeCategoryKindError(w, category)
+		return
+	}
 	existingIncome.CategoryID = category.ID
 
 	if updatedIncomeRequest.Note != nil {
 		existingIncome.Note = *updatedIncomeRequest.Note
 	}
+	// tags are kept unless given; an empty list removes them
+	if updatedIncomeRequest.Tags != nil {
+		existingIncome.Tags = store.NormalizeTags(*updatedIncomeRequest.Tags)
+	}
 
 	if updatedIncomeRequest.Source != nil {
 		existingIncome.Source = *updatedIncomeRequest.Source
 	}
+	// the payer is kept unless given; an empty name removes it
+	if updatedIncomeRequest.Payer != nil {
+		existingIncome.PayerID, existingIncome.Payer, err = h.resolvePayee(currentUser.ID, *updatedIncomeRequest.Payer)
+		if err != nil {
+			h.logger.Printf("Error: HandleUpdateIncome: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting payee"})
+			return
+		}
+	}
 	// if date is not provided, set it to now
 	if updatedIncomeRequest.Date == nil {
 		now := time.Now()
@@ -523,7 +978,18 @@ func (h *TransactionHandler) HandleGetTotalIncomes(w http.ResponseWriter, r *htt
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting total incomes"})
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"totalIncomes": totalIncomes})
+	if r.URL.Query().Get("convert") != "true" {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"totalIncomes": totalIncomes})
+		return
+	}
+
+	converted, err := h.transactionStore.GetTotalIncomesConverted(currentUser.ID, currentUser.BaseCurrency)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetTotalIncomes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error converting total incomes"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"totalIncomes": totalIncomes, "converted": converted})
 }
 
 func (h *TransactionHandler) HandleGetTransactions(w http.ResponseWriter, r *http.Request) {
@@ -533,29 +999,18 @@ func (h *TransactionHandler) HandleGetTransactions(w http.ResponseWriter, r *htt
 		return
 	}
 	limit, offset := utils.GetLimitOffset(r)
-	from, to, month, year, _type, categoryName, err := utils.GetTransactionQueryParams(r)
+	filter, err := h.readTransactionFilter(r, currentUser.ID)
 	if err != nil {
-		h.logger.Printf("Error: HandleGetTransactions: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "error parsing transaction query params"})
+		h.writeFilterError(w, "HandleGetTransactions", err)
 		return
 	}
 
-	var categoryID *int64
-	if categoryName != nil {
-		var err error
-		categoryID, err = h.categoryStore.GetCategoryIDByName(categoryName, currentUser.ID)
-		if err == sql.ErrNoRows {
-			h.logger.Printf("Error: HandleGetTransactions: %v", err)
-			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "category not found"})
-			return
-		}
-		if err != nil {
-			h.logger.Printf("Error: HandleGetTransactions: %v", err)
-			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "fetching category_id by name failed"})
-			return
-		}
+	// convert=true adds the amount in the user's base currency to every row
+	var baseCurrency *string
+	if r.URL.Query().Get("convert") == "true" {
+		baseCurrency = &currentUser.BaseCurrency
 	}
-	transactions, err := h.transactionStore.GetTransactions(currentUser.ID, limit, offset, from, to, month, year, _type, categoryID)
+	transactions, err := h.transactionStore.GetTransactions(currentUser.ID, limit, offset, *filter, baseCurrency)
 	if err != nil {
 		h.logger.Printf("Error: HandleGetTransactions: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting transactions"})
@@ -564,17 +1019,33 @@ func (h *TransactionHandler) HandleGetTransactions(w http.ResponseWriter, r *htt
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"transactions": transactions})
 }
 
-func (h *TransactionHandler) HandleGetCategories(w http.ResponseWriter, r *http.Request) {
+const maxDuplicateDays = 30
+
+// HandleGetDuplicates lists groups of expenses or incomes that look like the
+// same transaction booked more than once: same amount and currency, at most
+// ?days= apart (3 by default) and similar notes.
+func (h *TransactionHandler) HandleGetDuplicates(w http.ResponseWriter, r *http.Request) {
 	currentUser := middleware.GetUser(r)
 	if currentUser == nil {
 		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
 		return
 	}
-	categories, err := h.categoryStore.GetCategories(currentUser.ID)
+
+	days := duplicates.DefaultDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		var err error
+		days, err = strconv.Atoi(value)
+		if err != nil || days < 0 || days > maxDuplicateDays {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("days must be between 0 and %d", maxDuplicateDays)})
+			return
+		}
+	}
+
+	candidates, err := h.transactionStore.GetDuplicateCandidates(currentUser.ID, days)
 	if err != nil {
-		h.logger.Printf("Error: HandleGetCategories: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting categories"})
+		h.logger.Printf("Error: HandleGetDuplicates: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting transactions"})
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"categories": categories})
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"groups": duplicates.Group(candidates, days), "days": days})
 }
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/KartikSindura/money/internal/middleware"
+	"github.com/KartikSindura/money/internal/store"
+	"github.com/KartikSindura/money/utils"
+)
+
+type TransferHandler struct {
+	transferStore store.TransferStore
+	logger        *log.Logger
+}
+
+func NewTransferHandler(transferStore store.TransferStore, logger *log.Logger) *TransferHandler {
+	return &TransferHandler{
+		transferStore: transferStore,
+		logger:        logger,
+	}
+}
+
+// writeTransferError maps the account checks done by the store to a 400 and
+// everything else to a 500.
+func (h *TransferHandler) writeTransferError(w http.ResponseWriter, handler string, err error) {
+	if errors.Is(err, store.ErrTransferAccount) || errors.Is(err, store.ErrTransferCurrency) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	h.logger.Printf("Error: %s: %v", handler, err)
+	utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error saving transfer"})
+}
+
+func (h *TransferHandler) HandleCreateTransfer(w http.ResponseWriter, r *http.Request) {
+	transfer := &store.Transfer{}
+	err := json.NewDecoder(r.Body).Decode(&transfer)
+	if err != nil {
+		h.logger.Printf("Error: decodingHandleCreateTransfer: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "error decoding transfer"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+	transfer.UserID = currentUser.ID
+
+	if transfer.Amount <= 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "amount must be positive"})
+		return
+	}
+
+	// if date is not provided, use the current date
+	if transfer.Date == nil {
+		now := time.Now()
+		transfer.Date = &now
+	}
+
+	transfer, err = h.transferStore.CreateTransfer(transfer)
+	if err != nil {
+		h.writeTransferError(w, "HandleCreateTransfer", err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"transfer": transfer})
+}
+
+func (h *TransferHandler) HandleGetTransferByID(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetTransferByID: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	transfer, err := h.transferStore.GetTransferByID(id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "transfer not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleGetTransferByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting transfer"})
+		return
+	}
+
+	if transfer.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"transfer": transfer})
+}
+
+func (h *TransferHandler) HandleGetTransfers(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	limit, offset := utils.GetLimitOffset(r)
+	transfers, err := h.transferStore.GetTransfers(currentUser.ID, limit, offset)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetTransfers: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error getting transfers"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"transfers": transfers})
+}
+
+func (h *TransferHandler) HandleUpdateTransfer(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleUpdateTransfer: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	existingTransfer, err := h.transferStore.GetTransferByID(id)
+	if err != nil {
+		h.logger.Printf("Error: HandleUpdateTransfer: %v", err)
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "cannot find transfer"})
+		return
+	}
+	if existingTransfer.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+
+	var updatedTransferRequest struct {
+		FromAccountID *int64       `json:"from_account_id"`
+		ToAccountID   *int64       `json:"to_account_id"`
+		Amount        *store.Money `json:"amount"`
+		Note          *string      `json:"note"`
+		Date          *time.Time   `json:"date"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&updatedTransferRequest)
+	if err != nil {
+		h.logger.Printf("Error: decodingHandleUpdateTransfer: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "failed to decode request body"})
+		return
+	}
+
+	if updatedTransferRequest.FromAccountID != nil {
+		existingTransfer.FromAccountID = *updatedTransferRequest.FromAccountID
+	}
+	if updatedTransferRequest.ToAccountID != nil {
+		existingTransfer.ToAccountID = *updatedTransferRequest.ToAccountID
+	}
+	if updatedTransferRequest.Amount != nil {
+		if *updatedTransferRequest.Amount <= 0 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "amount must be positive"})
+			return
+		}
+		existingTransfer.Amount = *updatedTransferRequest.Amount
+	}
+	if updatedTransferRequest.Note != nil {
+		existingTransfer.Note = *updatedTransferRequest.Note
+	}
+	if updatedTransferRequest.Date != nil {
+		existingTransfer.Date = updatedTransferRequest.Date
+	}
+	existingTransfer.UpdatedAt = time.Now()
+
+	err = h.transferStore.UpdateTransfer(existingTransfer)
+	if err != nil {
+		h.writeTransferError(w, "HandleUpdateTransfer", err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"transfer": existingTransfer})
+}
+
+func (h *TransferHandler) HandleDeleteTransfer(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteTransfer: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid id parameter"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	transfer, err := h.transferStore.GetTransferByID(id)
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteTransfer: %v", err)
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "transfer not found"})
+		return
+	}
+	if transfer.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "access denied"})
+		return
+	}
+
+	err = h.transferStore.DeleteTransferByID(id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "transfer not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleDeleteTransfer: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error deleting transfer"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status": "transfer deleted"})
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KartikSindura/money/internal/middleware"
+	"github.com/KartikSindura/money/internal/store"
+	"github.com/KartikSindura/money/internal/totp"
+	"github.com/KartikSindura/money/utils"
+)
+
+// totpIssuer names the app in authenticator apps.
+const totpIssuer = "money"
+
+const recoveryCodeCount = 10
+
+type TwoFactorHandler struct {
+	twoFactorStore store.TwoFactorStore
+	logger         *log.Logger
+}
+
+func NewTwoFactorHandler(twoFactorStore store.TwoFactorStore, logger *log.Logger) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		twoFactorStore: twoFactorStore,
+		logger:         logger,
+	}
+}
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// newRecoveryCodes returns codes to show the user once, like
+// ABCD-EFGH-JKLM-NPQR, and the hashes to store for them.
+func newRecoveryCodes() ([]string, [][]byte, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+	for i := range codes {
+		secret := make([]byte, 10)
+		_, err := rand.Read(secret)
+		if err != nil {
+			return nil, nil, err
+		}
+		code := base32.StdEncoding.EncodeToString(secret)
+		codes[i] = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+		hashes[i] = hashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a recovery code the way it was typed, without
+// dashes or spaces and in any case.
+func hashRecoveryCode(code string) []byte {
+	code = strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(code))
+	return store.HashToken(code)
+}
+
+// checkSecondFactor accepts a current code from the authenticator app or an
+// unused recovery code, using either up.
+func checkSecondFactor(twoFactorStore store.TwoFactorStore, secret *store.TOTP, code string) (bool, error) {
+	step, ok := totp.Validate(secret.Secret, code, time.Now())
+	if ok {
+		return twoFactorStore.UseTOTPStep(secret.UserID, step)
+	}
+	return twoFactorStore.UseRecoveryCode(secret.UserID, hashRecoveryCode(code))
+}
+
+// HandleGetTwoFactor tells whether two-factor authentication is on and how
+// many recovery codes are left.
+func (h *TwoFactorHandler) HandleGetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	secret, err := h.twoFactorStore.GetTOTP(currentUser.ID)
+	if err == sql.ErrNoRows || (err == nil && !secret.Enabled()) {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"enabled": false})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleGetTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	left, err := h.twoFactorStore.CountRecoveryCodes(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("Error: HandleGetTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"enabled": true, "enabled_at": secret.EnabledAt, "recovery_codes_left": left})
+}
+
+// HandleSetupTwoFactor generates a secret for the user's authenticator app.
+// It does nothing until confirmed with a code, so a setup that is abandoned
+// cannot lock the user out.
+func (h *TwoFactorHandler) HandleSetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		h.logger.Printf("Error: HandleSetupTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = h.twoFactorStore.SetPendingTOTP(currentUser.ID, secret)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "two-factor authentication is already enabled"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleSetupTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(secret, totpIssuer, currentUser.Username),
+	})
+}
+
+// HandleConfirmTwoFactor enables two-factor authentication with a first code
+// from the authenticator app and hands out the recovery codes. They are only
+// ever shown here.
+func (h *TwoFactorHandler) HandleConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	var req twoFactorCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.Printf("Error: decodingConfirmTwoFactorRequest: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	secret, err := h.twoFactorStore.GetTOTP(currentUser.ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "two-factor setup has not been started"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleConfirmTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if secret.Enabled() {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "two-factor authentication is already enabled"})
+		return
+	}
+
+	step, ok := totp.Validate(secret.Secret, req.Code, time.Now())
+	if !ok {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		h.logger.Printf("Error: HandleConfirmTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	err = h.twoFactorStore.EnableTOTP(currentUser.ID, step, hashes)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "two-factor authentication is already enabled"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error: HandleConfirmTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "two-factor authentication enabled", "recovery_codes": codes})
+}
+
+// HandleRegenerateRecoveryCodes replaces all recovery codes, for when they
+// run out or may have been seen by someone else.
+func (h *TwoFactorHandler) HandleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	var req twoFactorCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.Printf("Error: decodingRegenerateRecoveryCodesRequest: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	secret, ok := h.enabledTOTP(w, currentUser.ID)
+	if !ok {
+		return
+	}
+	valid, err := checkSecondFactor(h.twoFactorStore, secret, req.Code)
+	if err != nil {
+		h.logger.Printf("Error: HandleRegenerateRecoveryCodes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !valid {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		h.logger.Printf("Error: HandleRegenerateRecoveryCodes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	err = h.twoFactorStore.ReplaceRecoveryCodes(currentUser.ID, hashes)
+	if err != nil {
+		h.logger.Printf("Error: HandleRegenerateRecoveryCodes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"recovery_codes": codes})
+}
+
+// HandleDisableTwoFactor turns two-factor authentication off. It takes the
+// password as well as a code, so a stolen access token alone cannot do it.
+func (h *TwoFactorHandler) HandleDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.Printf("Error: decodingDisableTwoFactorRequest: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	valid, err := currentUser.PasswordHash.Matches(req.Password)
+	if err != nil {
+		h.logger.Printf("Error: HandleDisableTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !valid {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid password"})
+		return
+	}
+
+	secret, ok := h.enabledTOTP(w, currentUser.ID)
+	if !ok {
+		return
+	}
+	valid, err = checkSecondFactor(h.twoFactorStore, secret, req.Code)
+	if err != nil {
+		h.logger.Printf("Error: HandleDisableTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !valid {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid code"})
+		return
+	}
+
+	err = h.twoFactorStore.DisableTOTP(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("Error: HandleDisableTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "two-factor authentication disabled"})
+}
+
+// enabledTOTP loads the user's secret, writing the error response when
+// two-factor authentication is not on.
+func (h *TwoFactorHandler) enabledTOTP(w http.ResponseWriter, userID int64) (*store.TOTP, bool) {
+	secret, err := h.twoFactorStore.GetTOTP(userID)
+	if err == sql.ErrNoRows || (err == nil && !secret.Enabled()) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "two-factor authentication is not enabled"})
+		return nil, false
+	}
+	if err != nil {
+		h.logger.Printf("Error: GetTOTP: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	return secret, true
+}
@@ -4,23 +4,33 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"regexp"
+	"time"
 
+	"github.com/KartikSindura/money/internal/mailer"
+	"github.com/KartikSindura/money/internal/middleware"
 	"github.com/KartikSindura/money/internal/store"
 	"github.com/KartikSindura/money/utils"
 )
 
 type UserHandler struct {
-	userStore store.UserStore
-	logger    *log.Logger
+	userStore            store.UserStore
+	sessionStore         store.SessionStore
+	twoFactorStore       store.TwoFactorStore
+	mailer               mailer.Mailer
+	requireVerifiedEmail bool // users cannot log in before verifying their email
+	logger               *log.Logger
 }
 
 type registerUserRequest struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Username     string `json:"username"`
+	Email        string `json:"email"`
+	Password     string `json:"password"`
+	BaseCurrency string `json:"base_currency"`
 }
 
 type loginUserRequest struct {
@@ -28,11 +38,110 @@ type loginUserRequest struct {
 	Password string `json:"password"`
 }
 
-func NewUserHandler(userStore store.UserStore, logger *log.Logger) *UserHandler {
+func NewUserHandler(userStore store.UserStore, sessionStore store.SessionStore, twoFactorStore store.TwoFactorStore, mailer mailer.Mailer, requireVerifiedEmail bool, logger *log.Logger) *UserHandler {
 	return &UserHandler{
-		userStore: userStore,
-		logger:    logger,
+		userStore:            userStore,
+		sessionStore:         sessionStore,
+		twoFactorStore:       twoFactorStore,
+		mailer:               mailer,
+		requireVerifiedEmail: requireVerifiedEmail,
+		logger:               logger,
+	}
+}
+
+const (
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+	loginChallengeTTL    = 5 * time.Minute
+)
+
+// mailToken sends the user a new single-use token for purpose.
+func (h *UserHandler) mailToken(user *store.User, purpose string) error {
+	token, tokenHash, err := store.NewToken()
+	if err != nil {
+		return err
 	}
+
+	message := mailer.Message{To: user.Email}
+	var ttl time.Duration
+	switch purpose {
+	case store.TokenPasswordReset:
+		ttl = passwordResetTTL
+		message.Subject = "Reset your password"
+		message.Body = fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your account. Use this token within the next hour to choose a new one:\n\n%s\n\nIf that was not you, you can ignore this mail.\n", user.Username, token)
+	case store.TokenEmailVerification:
+		ttl = emailVerificationTTL
+		message.Subject = "Verify your email"
+		message.Body = fmt.Sprintf("Hi %s,\n\nUse this token within the next 48 hours to verify your email address:\n\n%s\n", user.Username, token)
+	default:
+		return fmt.Errorf("unknown token purpose %q", purpose)
+	}
+
+	err = h.userStore.CreateUserToken(user.ID, purpose, tokenHash, time.Now().Add(ttl))
+	if err != nil {
+		return err
+	}
+	return h.mailer.Send(message)
+}
+
+// mailTokenInBackground sends the mail without making the request wait for
+// the mail server, which also keeps response times from telling whether an
+// address is registered.
+func (h *UserHandler) mailTokenInBackground(user *store.User, purpose string) {
+	go func() {
+		err := h.mailToken(user, purpose)
+		if err != nil {
+			h.logger.Printf("ERROR: mailToken %s: %v", purpose, err)
+		}
+	}()
+}
+
+// sessionTTL is how long a session lasts without being refreshed.
+const sessionTTL = 30 * 24 * time.Hour
+
+const maxUserAgentLength = 512
+
+// deviceSession describes the device a request comes from, for a session
+// that is started or refreshed by it. The address is the connecting one,
+// forwarding headers are not trusted.
+func deviceSession(r *http.Request) *store.Session {
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return &store.Session{UserAgent: userAgent, IPAddress: ip, ExpiresAt: time.Now().Add(sessionTTL)}
+}
+
+// startSession opens a session for the user on the device the request
+// comes from and returns its first access and refresh token.
+func (h *UserHandler) startSession(r *http.Request, userID int64) (utils.Envelope, error) {
+	refreshToken, tokenHash, err := store.NewToken()
+	if err != nil {
+		return nil, err
+	}
+	session := deviceSession(r)
+	session.UserID = userID
+	session, err = h.sessionStore.CreateSession(session, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	return tokenResponse(session, refreshToken)
+}
+
+func tokenResponse(session *store.Session, refreshToken string) (utils.Envelope, error) {
+	accessToken, err := utils.CreateToken(session.UserID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return utils.Envelope{
+		"token":         accessToken,
+		"expires_in":    int(utils.AccessTokenTTL.Seconds()),
+		"refresh_token": refreshToken,
+	}, nil
 }
 
 func (h *UserHandler) validateRegisterRequest(req *registerUserRequest) error {
@@ -52,6 +161,13 @@ func (h *UserHandler) validateRegisterRequest(req *registerUserRequest) error {
 		return errors.New("password is required")
 	}
 
+	if req.BaseCurrency != "" {
+		_, err := store.NormalizeCurrency(req.BaseCurrency)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -83,8 +199,12 @@ func (h *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request)
 	}
 
 	user := store.User{
-		Username: req.Username,
-		Email:    req.Email,
+		Username:     req.Username,
+		Email:        req.Email,
+		BaseCurrency: store.DefaultCurrency,
+	}
+	if req.BaseCurrency != "" {
+		user.BaseCurrency, _ = store.NormalizeCurrency(req.BaseCurrency)
 	}
 
 	err = user.PasswordHash.Set(req.Password)
@@ -101,14 +221,21 @@ func (h *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	tokenString, err := utils.CreateToken(user.ID)
+	h.mailTokenInBackground(&user, store.TokenEmailVerification)
+	if h.requireVerifiedEmail {
+		utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"message": "user registered, verify your email to log in"})
+		return
+	}
+
+	response, err := h.startSession(r, user.ID)
 	if err != nil {
-		h.logger.Printf("ERROR: CreateToken: %v", err)
+		h.logger.Printf("ERROR: startSession: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"message": "user registered", "token": tokenString})
+	response["message"] = "user registered"
+	utils.WriteJSON(w, http.StatusCreated, response)
 }
 
 func (h *UserHandler) HandleLoginUser(w http.ResponseWriter, r *http.Request) {
@@ -143,13 +270,365 @@ func (h *UserHandler) HandleLoginUser(w http.ResponseWriter, r *http.Request) {
 		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
 		return
 	}
+	if h.requireVerifiedEmail && !user.EmailVerified {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "email not verified"})
+		return
+	}
+
+	// with two-factor authentication on, the password only earns a challenge
+	// that is completed with a code at /login/2fa
+	secret, err := h.twoFactorStore.GetTOTP(user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		h.logger.Printf("ERROR: GetTOTP: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if err == nil && secret.Enabled() {
+		challengeToken, tokenHash, err := store.NewToken()
+		if err == nil {
+			err = h.twoFactorStore.CreateLoginChallenge(user.ID, tokenHash, time.Now().Add(loginChallengeTTL))
+		}
+		if err != nil {
+			h.logger.Printf("ERROR: CreateLoginChallenge: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+			"two_factor_required": true,
+			"challenge_token":     challengeToken,
+			"expires_in":          int(loginChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	response, err := h.startSession(r, user.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: startSession: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	response["message"] = "login successful"
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+// HandleLoginTwoFactor completes a login of a user with two-factor
+// authentication, taking the challenge token the password gave and a code
+// from the authenticator app or a recovery code. A challenge allows only a
+// few wrong codes.
+func (h *UserHandler) HandleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.Printf("ERROR: decodingLoginTwoFactorRequest: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+	if req.ChallengeToken == "" || req.Code == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "challenge_token and code are required"})
+		return
+	}
+
+	challengeHash := store.HashToken(req.ChallengeToken)
+	userID, err := h.twoFactorStore.AttemptLoginChallenge(challengeHash)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired challenge, log in again"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: HandleLoginTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	secret, err := h.twoFactorStore.GetTOTP(userID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired challenge, log in again"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: HandleLoginTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	valid, err := checkSecondFactor(h.twoFactorStore, secret, req.Code)
+	if err != nil {
+		h.logger.Printf("ERROR: HandleLoginTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !valid {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid code"})
+		return
+	}
+
+	err = h.twoFactorStore.DeleteLoginChallenge(challengeHash)
+	if err != nil {
+		h.logger.Printf("ERROR: HandleLoginTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	response, err := h.startSession(r, userID)
+	if err != nil {
+		h.logger.Printf("ERROR: startSession: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	response["message"] = "login successful"
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+// HandleRefreshToken trades a refresh token for a new access token and a new
+// refresh token. Each refresh token works once; using one again revokes the
+// whole session, since only a stolen copy would be used twice.
+func (h *UserHandler) HandleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.Printf("ERROR: decodingRefreshTokenRequest: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+	if req.RefreshToken == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "refresh_token is required"})
+		return
+	}
+
+	refreshToken, tokenHash, err := store.NewToken()
+	if err != nil {
+		h.logger.Printf("ERROR: HandleRefreshToken: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	session, err := h.sessionStore.RotateRefreshToken(store.HashToken(req.RefreshToken), tokenHash, deviceSession(r))
+	if errors.Is(err, store.ErrRefreshTokenReused) {
+		h.logger.Printf("ERROR: HandleRefreshToken: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "refresh token was already used, session revoked"})
+		return
+	}
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired refresh token"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: HandleRefreshToken: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
 
-	tokenString, err := utils.CreateToken(user.ID)
+	response, err := tokenResponse(session, refreshToken)
 	if err != nil {
 		h.logger.Printf("ERROR: CreateToken: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+// HandleLogout revokes the session of the access token used, which also
+// ends its refresh token.
+func (h *UserHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	err := h.sessionStore.RevokeSession(middleware.GetSessionID(r))
+	if err != nil && err != sql.ErrNoRows {
+		h.logger.Printf("ERROR: HandleLogout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "logged out"})
+}
+
+// HandleLogoutAll revokes every session of the user, including this one.
+func (h *UserHandler) HandleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	err := h.sessionStore.RevokeUserSessions(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: HandleLogoutAll: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "logged out of all sessions"})
+}
+
+func (h *UserHandler) HandleUpdateCurrentUser(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "must be logged in"})
+		return
+	}
+
+	var req struct {
+		BaseCurrency *string `json:"base_currency"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.Printf("ERROR: decodingUpdateCurrentUserRequest: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.BaseCurrency != nil {
+		currency, err := store.NormalizeCurrency(*req.BaseCurrency)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		err = h.userStore.UpdateBaseCurrency(currentUser.ID, currency)
+		if err != nil {
+			h.logger.Printf("ERROR: HandleUpdateCurrentUser: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error updating user"})
+			return
+		}
+		currentUser.BaseCurrency = currency
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": currentUser})
+}
+
+type emailRequest struct {
+	Email string `json:"email"`
+}
+
+// HandleForgotPassword mails a password reset token. The answer is the same
+// whether or not the address is registered.
+func (h *UserHandler) HandleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req emailRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.Printf("ERROR: decodingForgotPasswordRequest: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+	if req.Email == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "email is required"})
+		return
+	}
+
+	user, err := h.userStore.GetUserByEmail(req.Email)
+	if err != nil && err != sql.ErrNoRows {
+		h.logger.Printf("ERROR: HandleForgotPassword: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if err == nil {
+		h.mailTokenInBackground(user, store.TokenPasswordReset)
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "if the email is registered, a reset token has been sent to it"})
+}
+
+// HandleResetPassword sets a new password with a mailed reset token. All
+// sessions of the user are revoked, so they have to log in again.
+func (h *UserHandler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.Printf("ERROR: decodingResetPasswordRequest: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+	if req.Token == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "token is required"})
+		return
+	}
+	if req.Password == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "password is required"})
+		return
+	}
+
+	user := &store.User{}
+	err = user.PasswordHash.Set(req.Password)
+	if err != nil {
+		h.logger.Printf("ERROR: Password.Hash.Set: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = h.userStore.ResetPassword(store.HashToken(req.Token), user)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid or expired token"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: HandleResetPassword: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "password reset, log in with the new password"})
+}
 
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "login successful", "token": tokenString})
+// HandleVerifyEmail marks the user's email as verified with a mailed token.
+func (h *UserHandler) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.Printf("ERROR: decodingVerifyEmailRequest: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+	if req.Token == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "token is required"})
+		return
+	}
+
+	_, err = h.userStore.VerifyEmail(store.HashToken(req.Token))
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid or expired token"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: HandleVerifyEmail: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "email verified"})
+}
+
+// HandleResendVerification mails a new verification token. It needs no
+// login, since logging in may require a verified email, and like the
+// password reset it does not reveal whether the address is registered.
+func (h *UserHandler) HandleResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req emailRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.Printf("ERROR: decodingResendVerificationRequest: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+	if req.Email == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "email is required"})
+		return
+	}
+
+	user, err := h.userStore.GetUserByEmail(req.Email)
+	if err != nil && err != sql.ErrNoRows {
+		h.logger.Printf("ERROR: HandleResendVerification: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if err == nil && !user.EmailVerified {
+		h.mailTokenInBackground(user, store.TokenEmailVerification)
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "if the email is registered and not verified yet, a verification token has been sent to it"})
 }
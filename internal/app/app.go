@@ -6,9 +6,13 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/KartikSindura/money/internal/api"
+	"github.com/KartikSindura/money/internal/classifier"
+	"github.com/KartikSindura/money/internal/mailer"
 	"github.com/KartikSindura/money/internal/middleware"
+	"github.com/KartikSindura/money/internal/recurring"
 	"github.com/KartikSindura/money/internal/store"
 	"github.com/KartikSindura/money/migrations"
 )
@@ -18,7 +22,20 @@ type Application struct {
 	DB                 *sql.DB
 	TransactionHandler *api.TransactionHandler
 	UserHandler        *api.UserHandler
+	RecurringHandler   *api.RecurringHandler
+	BudgetHandler      *api.BudgetHandler
+	AccountHandler     *api.AccountHandler
+	TransferHandler    *api.TransferHandler
+	ReportHandler      *api.ReportHandler
+	CategoryHandler    *api.CategoryHandler
+	TagHandler         *api.TagHandler
+	PayeeHandler       *api.PayeeHandler
+	RuleHandler        *api.RuleHandler
+	SessionHandler     *api.SessionHandler
+	TwoFactorHandler   *api.TwoFactorHandler
+	APIKeyHandler      *api.APIKeyHandler
 	Middleware         middleware.UserMiddleware
+	RecurringWorker    *recurring.Worker
 }
 
 func NewApplication() (*Application, error) {
@@ -36,27 +53,103 @@ func NewApplication() (*Application, error) {
 	postgresTransactionStore := store.NewPostgresTransactionStore(pgDb)
 	postgresCategoryStore := store.NewPostgresCategoryStore(pgDb)
 	postgresUserStore := store.NewPostgresUserStore(pgDb)
+	postgresRecurringStore := store.NewPostgresRecurringStore(pgDb)
+	postgresBudgetStore := store.NewPostgresBudgetStore(pgDb)
+	postgresExchangeRateStore := store.NewPostgresExchangeRateStore(pgDb)
+	postgresAccountStore := store.NewPostgresAccountStore(pgDb)
+	postgresTransferStore := store.NewPostgresTransferStore(pgDb)
+	postgresReportStore := store.NewPostgresReportStore(pgDb)
+	postgresTagStore := store.NewPostgresTagStore(pgDb)
+	postgresPayeeStore := store.NewPostgresPayeeStore(pgDb)
+	postgresRuleStore := store.NewPostgresRuleStore(pgDb)
+	postgresSessionStore := store.NewPostgresSessionStore(pgDb)
+	postgresTwoFactorStore := store.NewPostgresTwoFactorStore(pgDb)
+	postgresAPIKeyStore := store.NewPostgresAPIKeyStore(pgDb)
+
+	// exchange rates are loaded from a local file, never fetched over the network
+	if ratesFile := os.Getenv("EXCHANGE_RATES_FILE"); ratesFile != "" {
+		err = loadExchangeRates(postgresExchangeRateStore, ratesFile, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	categoryClassifier := classifier.New(postgresTransactionStore, postgresCategoryStore)
+
+	// users can be required to verify their email before logging in
+	requireVerifiedEmail := os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true"
 
 	// handlers
-	transactionHandler := api.NewTransactionHandler(postgresTransactionStore, postgresCategoryStore, logger)
-	userHandler := api.NewUserHandler(postgresUserStore, logger)
+	transactionHandler := api.NewTransactionHandler(postgresTransactionStore, postgresCategoryStore, postgresAccountStore, postgresPayeeStore, postgresRuleStore, categoryClassifier, logger)
+	userHandler := api.NewUserHandler(postgresUserStore, postgresSessionStore, postgresTwoFactorStore, mailer.FromEnv(logger), requireVerifiedEmail, logger)
+	recurringHandler := api.NewRecurringHandler(postgresRecurringStore, postgresCategoryStore, postgresAccountStore, logger)
+	budgetHandler := api.NewBudgetHandler(postgresBudgetStore, postgresCategoryStore, logger)
+	accountHandler := api.NewAccountHandler(postgresAccountStore, logger)
+	transferHandler := api.NewTransferHandler(postgresTransferStore, logger)
+	reportHandler := api.NewReportHandler(postgresReportStore, postgresCategoryStore, logger)
+	categoryHandler := api.NewCategoryHandler(postgresCategoryStore, categoryClassifier, logger)
+	tagHandler := api.NewTagHandler(postgresTagStore, logger)
+	payeeHandler := api.NewPayeeHandler(postgresPayeeStore, logger)
+	ruleHandler := api.NewRuleHandler(postgresRuleStore, postgresTransactionStore, postgresCategoryStore, postgresAccountStore, postgresPayeeStore, categoryClassifier, logger)
+	sessionHandler := api.NewSessionHandler(postgresSessionStore, logger)
+	twoFactorHandler := api.NewTwoFactorHandler(postgresTwoFactorStore, logger)
+	apiKeyHandler := api.NewAPIKeyHandler(postgresAPIKeyStore, logger)
 
 	// middleware
 	userMiddleware := middleware.UserMiddleware{
-		UserStore: postgresUserStore,
+		UserStore:    postgresUserStore,
+		SessionStore: postgresSessionStore,
+		APIKeyStore:  postgresAPIKeyStore,
+		Logger:       logger,
 	}
 
+	// workers
+	recurringWorker := recurring.NewWorker(postgresRecurringStore, time.Hour, logger)
+	recurringWorker.Start()
+
 	app := &Application{
 		Logger:             logger,
 		DB:                 pgDb,
 		TransactionHandler: transactionHandler,
 		UserHandler:        userHandler,
+		RecurringHandler:   recurringHandler,
+		BudgetHandler:      budgetHandler,
+		AccountHandler:     accountHandler,
+		TransferHandler:    transferHandler,
+		ReportHandler:      reportHandler,
+		CategoryHandler:    categoryHandler,
+		TagHandler:         tagHandler,
+		PayeeHandler:       payeeHandler,
+		RuleHandler:        ruleHandler,
+		SessionHandler:     sessionHandler,
+		TwoFactorHandler:   twoFactorHandler,
+		APIKeyHandler:      apiKeyHandler,
 		Middleware:         userMiddleware,
+		RecurringWorker:    recurringWorker,
 	}
 
 	return app, nil
 }
 
+func loadExchangeRates(exchangeRateStore store.ExchangeRateStore, path string, logger *log.Logger) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("exchange rates: %w", err)
+	}
+	defer file.Close()
+
+	rates, err := store.ReadExchangeRatesCSV(file)
+	if err != nil {
+		return fmt.Errorf("exchange rates: %s: %w", path, err)
+	}
+	err = exchangeRateStore.UpsertExchangeRates(rates)
+	if err != nil {
+		return fmt.Errorf("exchange rates: %w", err)
+	}
+	logger.Printf("loaded %d exchange rates from %s", len(rates), path)
+	return nil
+}
+
 func (a *Application) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Health gud")
 }
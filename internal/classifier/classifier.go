@@ -0,0 +1,275 @@
+package classifier
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/KartikSindura/money/internal/store"
+)
+
+// maxAge bounds how stale a model can get through changes the handlers do
+// not report, like expenses posted by the recurring worker.
+const maxAge = 24 * time.Hour
+
+// Example is one categorized expense the classifier learns from.
+type Example struct {
+	CategoryID int64
+	Note       string
+	Payee      *string
+	Amount     store.Money
+}
+
+// ExampleOf takes the fields the classifier looks at from an expense.
+func ExampleOf(expense *store.Expense) Example {
+	return Example{
+		CategoryID: expense.CategoryID,
+		Note:       expense.Note,
+		Payee:      expense.Payee,
+		Amount:     expense.Amount,
+	}
+}
+
+type Suggestion struct {
+	CategoryID int64   `json:"category_id"`
+	Category   string  `json:"category"`
+	Confidence float64 `json:"confidence"` // between 0 and 1, summing to 1 over all categories
+}
+
+// model is a multinomial naive Bayes model over the tokens of one user's
+// expenses.
+type model struct {
+	uncategorized *int64 // never learned or suggested
+	examples      map[int64]int
+	tokens        map[int64]map[string]int
+	totals        map[int64]int  // tokens seen per category
+	vocabulary    map[string]int // how often each token was seen at all
+	count         int
+	trainedAt     time.Time
+}
+
+func newModel(uncategorized *int64) *model {
+	return &model{
+		uncategorized: uncategorized,
+		examples:      map[int64]int{},
+		tokens:        map[int64]map[string]int{},
+		totals:        map[int64]int{},
+		vocabulary:    map[string]int{},
+		trainedAt:     time.Now(),
+	}
+}
+
+// update adds an example, or takes one away again with a delta of -1.
+func (m *model) update(example Example, delta int) {
+	if m.uncategorized != nil && example.CategoryID == *m.uncategorized {
+		return
+	}
+	if delta < 0 && m.examples[example.CategoryID] == 0 {
+		return
+	}
+
+	m.examples[example.CategoryID] += delta
+	m.count += delta
+	if m.tokens[example.CategoryID] == nil {
+		m.tokens[example.CategoryID] = map[string]int{}
+	}
+	for _, token := range tokenize(example.Note, example.Payee, example.Amount) {
+		m.tokens[example.CategoryID][token] += delta
+		m.totals[example.CategoryID] += delta
+		m.vocabulary[token] += delta
+		if m.vocabulary[token] <= 0 {
+			delete(m.vocabulary, token)
+		}
+	}
+	if m.examples[example.CategoryID] <= 0 {
+		delete(m.examples, example.CategoryID)
+		delete(m.tokens, example.CategoryID)
+		delete(m.totals, example.CategoryID)
+	}
+}
+
+// suggest scores every category with Laplace smoothing and turns the scores
+// into probabilities. Tokens never seen before say nothing and are skipped.
+func (m *model) suggest(note string, payee *string, amount store.Money) []Suggestion {
+	if m.count == 0 {
+		return []Suggestion{}
+	}
+
+	known := []string{}
+	for _, token := range tokenize(note, payee, amount) {
+		if m.vocabulary[token] > 0 {
+			known = append(known, token)
+		}
+	}
+
+	scores := map[int64]float64{}
+	best := math.Inf(-1)
+	vocabularySize := float64(len(m.vocabulary))
+	for categoryID, examples := range m.examples {
+		score := math.Log(float64(examples) / float64(m.count))
+		for _, token := range known {
+			score += math.Log(float64(m.tokens[categoryID][token]+1) / (float64(m.totals[categoryID]) + vocabularySize))
+		}
+		scores[categoryID] = score
+		best = math.Max(best, score)
+	}
+
+	sum := 0.0
+	suggestions := []Suggestion{}
+	for categoryID, score := range scores {
+		p := math.Exp(score - best)
+		sum += p
+		suggestions = append(suggestions, Suggestion{CategoryID: categoryID, Confidence: p})
+	}
+	for i := range suggestions {
+		suggestions[i].Confidence /= sum
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Confidence != suggestions[j].Confidence {
+			return suggestions[i].Confidence > suggestions[j].Confidence
+		}
+		return suggestions[i].CategoryID < suggestions[j].CategoryID
+	})
+	return suggestions
+}
+
+// tokenize splits the note and payee into lower-case words and adds the
+// order of magnitude of the amount. Payee words are kept apart from note
+// words, and plain numbers like reference codes are dropped.
+func tokenize(note string, payee *string, amount store.Money) []string {
+	tokens := words(note, "")
+	if payee != nil {
+		tokens = append(tokens, words(*payee, "payee:")...)
+	}
+	if amount > 0 {
+		tokens = append(tokens, "amount:"+strconv.Itoa(len(strconv.FormatInt(int64(amount)/100, 10))))
+	}
+	return tokens
+}
+
+func words(text string, prefix string) []string {
+	tokens := []string{}
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, field := range fields {
+		if len([]rune(field)) < 2 || strings.IndexFunc(field, unicode.IsLetter) < 0 {
+			continue
+		}
+		tokens = append(tokens, prefix+field)
+	}
+	return tokens
+}
+
+// Classifier suggests categories for expenses from the user's own history.
+// Each user's model is trained from the database on first use and then kept
+// up to date by Learn and Forget; Invalidate drops it after bulk changes.
+type Classifier struct {
+	transactionStore store.TransactionStore
+	categoryStore    store.CategoryStore
+	mu               sync.Mutex // guards users only
+	users            map[int64]*userModel
+}
+
+// userModel is held while the user's model trains, so an expense learned
+// concurrently cannot be missed or counted twice, without making other
+// users wait for the database.
+type userModel struct {
+	mu    sync.Mutex
+	model *model // nil until trained
+}
+
+func New(transactionStore store.TransactionStore, categoryStore store.CategoryStore) *Classifier {
+	return &Classifier{
+		transactionStore: transactionStore,
+		categoryStore:    categoryStore,
+		users:            map[int64]*userModel{},
+	}
+}
+
+// lock returns the user's entry with its mutex held.
+func (c *Classifier) lock(userID int64) *userModel {
+	c.mu.Lock()
+	u, ok := c.users[userID]
+	if !ok {
+		u = &userModel{}
+		c.users[userID] = u
+	}
+	c.mu.Unlock()
+
+	u.mu.Lock()
+	return u
+}
+
+// train builds the model of one user from all their expenses.
+func (c *Classifier) train(userID int64) (*model, error) {
+	name := "uncategorized"
+	uncategorized, err := c.categoryStore.GetCategoryIDByName(&name, userID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	m := newModel(uncategorized)
+	err = c.transactionStore.StreamExpenses(userID, func(expense *store.Expense) error {
+		m.update(ExampleOf(expense), 1)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Suggest ranks the categories of the user's past expenses for a new one,
+// most likely first, returning at most limit of them.
+func (c *Classifier) Suggest(userID int64, note string, payee *string, amount store.Money, limit int) ([]Suggestion, error) {
+	u := c.lock(userID)
+	defer u.mu.Unlock()
+
+	if u.model == nil || time.Since(u.model.trainedAt) > maxAge {
+		m, err := c.train(userID)
+		if err != nil {
+			return nil, err
+		}
+		u.model = m
+	}
+
+	suggestions := u.model.suggest(note, payee, amount)
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// Learn adds a new or re-categorized expense to the user's model. Users
+// without a model yet are left alone, it is trained in full when needed.
+func (c *Classifier) Learn(userID int64, example Example) {
+	u := c.lock(userID)
+	defer u.mu.Unlock()
+	if u.model != nil {
+		u.model.update(example, 1)
+	}
+}
+
+// Forget takes back what was learned from an expense before it was changed
+// or deleted.
+func (c *Classifier) Forget(userID int64, example Example) {
+	u := c.lock(userID)
+	defer u.mu.Unlock()
+	if u.model != nil {
+		u.model.update(example, -1)
+	}
+}
+
+// Invalidate drops the user's model so the next suggestion retrains it, for
+// changes too broad to follow one expense at a time.
+func (c *Classifier) Invalidate(userID int64) {
+	u := c.lock(userID)
+	defer u.mu.Unlock()
+	u.model = nil
+}
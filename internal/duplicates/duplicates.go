@@ -0,0 +1,132 @@
+package duplicates
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/KartikSindura/money/internal/store"
+)
+
+// DefaultDays is how many days apart two bookings of the same amount may be
+// and still count as one purchase entered twice.
+const DefaultDays = 3
+
+// minOverlap is the share of words two notes must have in common.
+const minOverlap = 0.5
+
+// Same reports whether two transactions look like one purchase booked twice:
+// same type, amount and currency, at most days apart, no conflicting payees
+// and similar notes. Two postings of the same recurring rule are never the
+// same purchase.
+func Same(a *store.Transaction, b *store.Transaction, days int) bool {
+	if a.Type != b.Type || a.Amount != b.Amount || a.Currency != b.Currency {
+		return false
+	}
+	if a.RecurringRuleID != nil && b.RecurringRuleID != nil && *a.RecurringRuleID == *b.RecurringRuleID {
+		return false
+	}
+	apart := a.Date.Sub(b.Date)
+	if apart < 0 {
+		apart = -apart
+	}
+	if apart > time.Duration(days)*24*time.Hour {
+		return false
+	}
+	if a.Payee != nil && b.Payee != nil && !strings.EqualFold(*a.Payee, *b.Payee) {
+		return false
+	}
+	return SimilarNotes(a.Note, b.Note)
+}
+
+// SimilarNotes compares notes by their words, ignoring case and punctuation.
+// Notes are similar when one's words contain the other's, or when at least
+// half of all their words are shared. Two empty notes are similar, an empty
+// and a non-empty one are not.
+func SimilarNotes(a string, b string) bool {
+	wordsA, wordsB := words(a), words(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return len(wordsA) == len(wordsB)
+	}
+
+	shared := 0
+	for word := range wordsA {
+		if wordsB[word] {
+			shared++
+		}
+	}
+	if shared == min(len(wordsA), len(wordsB)) {
+		return true
+	}
+	union := len(wordsA) + len(wordsB) - shared
+	return float64(shared)/float64(union) >= minOverlap
+}
+
+func words(text string) map[string]bool {
+	set := map[string]bool{}
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, field := range fields {
+		set[field] = true
+	}
+	return set
+}
+
+// Group puts transactions that are duplicates of each other, directly or
+// through another one, into groups of at least two. The transactions must be
+// ordered by type, amount, currency and date, like GetDuplicateCandidates
+// returns them. Groups are ordered by their first transaction.
+func Group(transactions []store.Transaction, days int) [][]store.Transaction {
+	parent := make([]int, len(transactions))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range transactions {
+		for j := i + 1; j < len(transactions); j++ {
+			a, b := &transactions[i], &transactions[j]
+			if a.Type != b.Type || a.Amount != b.Amount || a.Currency != b.Currency || b.Date.Sub(a.Date) > time.Duration(days)*24*time.Hour {
+				break
+			}
+			if Same(a, b, days) {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	members := map[int][]store.Transaction{}
+	for i := range transactions {
+		root := find(i)
+		members[root] = append(members[root], transactions[i])
+	}
+
+	groups := [][]store.Transaction{}
+	for _, group := range members {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool {
+			if !group[i].Date.Equal(group[j].Date) {
+				return group[i].Date.Before(group[j].Date)
+			}
+			return group[i].ID < group[j].ID
+		})
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if !groups[i][0].Date.Equal(groups[j][0].Date) {
+			return groups[i][0].Date.Before(groups[j][0].Date)
+		}
+		return groups[i][0].ID < groups[j][0].ID
+	})
+	return groups
+}
@@ -0,0 +1,66 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/KartikSindura/money/internal/store"
+)
+
+// flushEvery bounds how many rows are buffered before they are sent.
+const flushEvery = 100
+
+type csvWriter struct {
+	writer *csv.Writer
+	lookup *lookup
+	rows   int
+}
+
+func newCSVWriter(w io.Writer, l *lookup) (*csvWriter, error) {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"id", "date", "type", "amount", "currency", "category", "account", "to_account", "payee", "source", "note"})
+	if err != nil {
+		return nil, err
+	}
+	return &csvWriter{writer: writer, lookup: l}, nil
+}
+
+func (c *csvWriter) Write(transaction *store.Transaction) error {
+	payee, source := "", ""
+	if transaction.Payee != nil {
+		payee = *transaction.Payee
+	}
+	if transaction.Source != nil {
+		source = *transaction.Source
+	}
+	err := c.writer.Write([]string{
+		strconv.FormatInt(transaction.ID, 10),
+		transaction.Date.Format(time.RFC3339),
+		transaction.Type,
+		transaction.Amount.String(),
+		transaction.Currency,
+		c.lookup.category(transaction.CategoryID),
+		c.lookup.accountName(transaction.AccountID),
+		c.lookup.accountName(transaction.ToAccountID),
+		payee,
+		source,
+		transaction.Note,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.rows++
+	if c.rows%flushEvery == 0 {
+		c.writer.Flush()
+		return c.writer.Error()
+	}
+	return nil
+}
+
+func (c *csvWriter) Close() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
@@ -0,0 +1,96 @@
+// Package export writes a user's transactions in formats other tools can
+// read. Writers receive transactions one at a time, so an export can be
+// streamed straight from a database cursor.
+package export
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/KartikSindura/money/internal/store"
+)
+
+// Writer writes one export. Write is called once per transaction in date
+// order and Close finishes the document; it does not close the underlying
+// io.Writer.
+type Writer interface {
+	Write(transaction *store.Transaction) error
+	Close() error
+}
+
+// Formats lists the supported values of the format parameter.
+var Formats = []string{"csv", "json", "ledger"}
+
+// ContentType returns the MIME type and file extension for a format.
+func ContentType(format string) (string, string) {
+	switch format {
+	case "json":
+		return "application/json", "json"
+	case "ledger":
+		return "text/plain; charset=utf-8", "ledger"
+	default:
+		return "text/csv; charset=utf-8", "csv"
+	}
+}
+
+// lookup resolves the ids on a transaction to names.
+type lookup struct {
+	categories map[int64]string
+	accounts   map[int64]store.Account
+}
+
+func newLookup(categories []store.Category, accounts []store.Account) *lookup {
+	l := &lookup{
+		categories: map[int64]string{},
+		accounts:   map[int64]store.Account{},
+	}
+	for _, category := range categories {
+		l.categories[category.ID] = category.Path
+	}
+	for _, account := range accounts {
+		l.accounts[account.ID] = account
+	}
+	return l
+}
+
+func (l *lookup) category(id *int64) string {
+	if id == nil {
+		return ""
+	}
+	return l.categories[*id]
+}
+
+func (l *lookup) account(id *int64) *store.Account {
+	if id == nil {
+		return nil
+	}
+	account, ok := l.accounts[*id]
+	if !ok {
+		return nil
+	}
+	return &account
+}
+
+func (l *lookup) accountName(id *int64) string {
+	if account := l.account(id); account != nil {
+		return account.Name
+	}
+	return ""
+}
+
+// New starts an export in the given format. Categories and accounts are
+// written up front by formats that have a place for them and are used to
+// resolve names on every transaction.
+func New(format string, w io.Writer, categories []store.Category, accounts []store.Account) (Writer, error) {
+	l := newLookup(categories, accounts)
+	switch format {
+	case "csv":
+		return newCSVWriter(w, l)
+	case "json":
+		return newJSONWriter(w, l, categories, accounts)
+	case "ledger":
+		return newLedgerWriter(w, l)
+	default:
+		return nil, fmt.Errorf("format must be one of %v", Formats)
+	}
+}
@@ -0,0 +1,87 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/KartikSindura/money/internal/store"
+)
+
+// jsonWriter writes {"categories": [...], "accounts": [...],
+// "transactions": [...]}, encoding transactions one by one instead of
+// building the whole array first.
+type jsonWriter struct {
+	writer *bufio.Writer
+	lookup *lookup
+	rows   int
+}
+
+// jsonTransaction adds the resolved names to a transaction.
+type jsonTransaction struct {
+	*store.Transaction
+	Category  string `json:"category,omitempty"`
+	Account   string `json:"account,omitempty"`
+	ToAccount string `json:"to_account,omitempty"`
+}
+
+func newJSONWriter(w io.Writer, l *lookup, categories []store.Category, accounts []store.Account) (*jsonWriter, error) {
+	if categories == nil {
+		categories = []store.Category{}
+	}
+	if accounts == nil {
+		accounts = []store.Account{}
+	}
+
+	writer := bufio.NewWriter(w)
+	head, err := json.Marshal(map[string]any{"categories": categories, "accounts": accounts})
+	if err != nil {
+		return nil, err
+	}
+	// reopen the object to append the transactions array
+	_, err = writer.Write(head[:len(head)-1])
+	if err != nil {
+		return nil, err
+	}
+	_, err = writer.WriteString(`,"transactions":[`)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonWriter{writer: writer, lookup: l}, nil
+}
+
+func (j *jsonWriter) Write(transaction *store.Transaction) error {
+	if j.rows > 0 {
+		err := j.writer.WriteByte(',')
+		if err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(jsonTransaction{
+		Transaction: transaction,
+		Category:    j.lookup.category(transaction.CategoryID),
+		Account:     j.lookup.accountName(transaction.AccountID),
+		ToAccount:   j.lookup.accountName(transaction.ToAccountID),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = j.writer.Write(data)
+	if err != nil {
+		return err
+	}
+
+	j.rows++
+	if j.rows%flushEvery == 0 {
+		return j.writer.Flush()
+	}
+	return nil
+}
+
+func (j *jsonWriter) Close() error {
+	_, err := j.writer.WriteString("]}\n")
+	if err != nil {
+		return err
+	}
+	return j.writer.Flush()
+}
@@ -0,0 +1,105 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/KartikSindura/money/internal/store"
+)
+
+// ledgerWriter writes plain-text double-entry journal entries that ledger
+// and hledger can read. Expenses move money from an asset or liability
+// account to Expenses:<category>, incomes from Income:<category> to the
+// account, and transfers between two accounts.
+type ledgerWriter struct {
+	writer *bufio.Writer
+	lookup *lookup
+	rows   int
+}
+
+// unassignedAccount holds transactions that were booked without an account.
+const unassignedAccount = "Assets:Unassigned"
+
+func newLedgerWriter(w io.Writer, l *lookup) (*ledgerWriter, error) {
+	return &ledgerWriter{writer: bufio.NewWriter(w), lookup: l}, nil
+}
+
+func (lw *ledgerWriter) Write(transaction *store.Transaction) error {
+	payee := transaction.Note
+	if transaction.Payee != nil {
+		payee = *transaction.Payee
+	} else if transaction.Source != nil && *transaction.Source != "" {
+		payee = *transaction.Source
+	}
+	if payee == "" {
+		payee = transaction.Type
+	}
+
+	account := lw.ledgerAccount(transaction.AccountID)
+	category := ledgerName(lw.lookup.category(transaction.CategoryID))
+	if category == "" {
+		category = "Uncategorized"
+	}
+
+	var to, from string
+	switch transaction.Type {
+	case "expense":
+		to, from = "Expenses:"+category, account
+	case "income":
+		to, from = account, "Income:"+category
+	case "transfer":
+		to, from = lw.ledgerAccount(transaction.ToAccountID), account
+	default:
+		return fmt.Errorf("unknown transaction type %q", transaction.Type)
+	}
+
+	entry := fmt.Sprintf("%s %s\n", transaction.Date.Format("2006/01/02"), ledgerText(payee))
+	if transaction.Note != "" && transaction.Note != payee {
+		entry += fmt.Sprintf("    ; %s\n", ledgerText(transaction.Note))
+	}
+	entry += fmt.Sprintf("    %-40s  %s %s\n", to, transaction.Amount, transaction.Currency)
+	entry += fmt.Sprintf("    %s\n\n", from)
+
+	_, err := lw.writer.WriteString(entry)
+	if err != nil {
+		return err
+	}
+
+	lw.rows++
+	if lw.rows%flushEvery == 0 {
+		return lw.writer.Flush()
+	}
+	return nil
+}
+
+func (lw *ledgerWriter) Close() error {
+	return lw.writer.Flush()
+}
+
+// ledgerAccount names credit cards and loans as liabilities, everything
+// else as assets.
+func (lw *ledgerWriter) ledgerAccount(id *int64) string {
+	account := lw.lookup.account(id)
+	if account == nil {
+		return unassignedAccount
+	}
+	name := ledgerName(account.Name)
+	if account.Type == "credit" || account.Type == "loan" {
+		return "Liabilities:" + name
+	}
+	return "Assets:" + name
+}
+
+// ledgerName makes a name safe to use as an account segment. Ledger ends an
+// account name at two spaces or a tab, and ':' would start a sub-account.
+func ledgerName(name string) string {
+	name = strings.Join(strings.Fields(name), " ")
+	return strings.ReplaceAll(name, ":", "-")
+}
+
+// ledgerText keeps free text on a single line.
+func ledgerText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,225 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/KartikSindura/money/internal/store"
+)
+
+// CSVMapping tells the parser which header columns hold which field. Either
+// AmountColumn (signed, negative is an expense) or DebitColumn and/or
+// CreditColumn must be set.
+type CSVMapping struct {
+	DateColumn        string `json:"date_column"`
+	DateFormat        string `json:"date_format"` // e.g. "DD/MM/YYYY", defaults to "YYYY-MM-DD"
+	AmountColumn      string `json:"amount_column"`
+	DebitColumn       string `json:"debit_column"`
+	CreditColumn      string `json:"credit_column"`
+	DescriptionColumn string `json:"description_column"`
+	CategoryColumn    string `json:"category_column"`
+	// for statements that list spending as positive amounts
+	InvertAmount     bool   `json:"invert_amount"`
+	Delimiter        string `json:"delimiter"`         // defaults to ","
+	DecimalSeparator string `json:"decimal_separator"` // "." or ",", defaults to "."
+	SkipRows         int    `json:"skip_rows"`         // lines before the header row
+}
+
+func (m *CSVMapping) decimalSeparator() rune {
+	if m.DecimalSeparator == "," {
+		return ','
+	}
+	return '.'
+}
+
+func (m *CSVMapping) Validate() error {
+	if m.DateColumn == "" {
+		return errors.New("date_column is required")
+	}
+	if m.AmountColumn == "" && m.DebitColumn == "" && m.CreditColumn == "" {
+		return errors.New("amount_column or debit_column/credit_column is required")
+	}
+	if m.AmountColumn != "" && (m.DebitColumn != "" || m.CreditColumn != "") {
+		return errors.New("use either amount_column or debit_column/credit_column, not both")
+	}
+	if m.Delimiter != "" && utf8.RuneCountInString(m.Delimiter) != 1 {
+		return errors.New("delimiter must be a single character")
+	}
+	if m.DecimalSeparator != "" && m.DecimalSeparator != "." && m.DecimalSeparator != "," {
+		return errors.New(`decimal_separator must be "." or ","`)
+	}
+	if m.DecimalSeparator != "" && m.DecimalSeparator == m.Delimiter {
+		return errors.New("decimal_separator and delimiter must differ")
+	}
+	if m.SkipRows < 0 {
+		return errors.New("skip_rows must not be negative")
+	}
+	return nil
+}
+
+// ParseCSV reads a statement with a header row. Problems with single rows
+// are reported on the row, only an unreadable file or a mapping that does
+// not match the header returns an error.
+func ParseCSV(r io.Reader, mapping CSVMapping) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if mapping.Delimiter != "" {
+		reader.Comma, _ = utf8.DecodeRuneInString(mapping.Delimiter)
+	}
+
+	line := 0
+	for ; line < mapping.SkipRows; line++ {
+		_, err := reader.Read()
+		if err == io.EOF {
+			return nil, errors.New("file has no header row")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("file has no header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+	line++
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+	column := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		i, ok := columns[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return -1, fmt.Errorf("column %q not found in header", name)
+		}
+		return i, nil
+	}
+
+	dateCol, err := column(mapping.DateColumn)
+	if err != nil {
+		return nil, err
+	}
+	amountCol, err := column(mapping.AmountColumn)
+	if err != nil {
+		return nil, err
+	}
+	debitCol, err := column(mapping.DebitColumn)
+	if err != nil {
+		return nil, err
+	}
+	creditCol, err := column(mapping.CreditColumn)
+	if err != nil {
+		return nil, err
+	}
+	descriptionCol, err := column(mapping.DescriptionColumn)
+	if err != nil {
+		return nil, err
+	}
+	categoryCol, err := column(mapping.CategoryColumn)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := dateLayout(mapping.DateFormat)
+	rows := []Row{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line++
+
+		// blank lines at the end of exports are common
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		field := func(i int) string {
+			if i < 0 || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		row := Row{
+			Line:        line,
+			Description: field(descriptionCol),
+			Category:    field(categoryCol),
+		}
+
+		date, err := time.Parse(layout, field(dateCol))
+		if err != nil {
+			row.addError(fmt.Sprintf("invalid date %q, expected format %q", field(dateCol), layout))
+		} else {
+			row.Date = &date
+		}
+
+		if amountCol >= 0 {
+			amount, err := ParseAmount(field(amountCol), mapping.decimalSeparator())
+			if err != nil {
+				row.addError(fmt.Sprintf("invalid amount %q", field(amountCol)))
+			} else {
+				if mapping.InvertAmount {
+					amount = -amount
+				}
+				row.setSignedAmount(amount)
+			}
+		} else {
+			parseDebitCredit(&row, field(debitCol), field(creditCol), mapping.decimalSeparator())
+		}
+
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseDebitCredit handles statements with separate withdrawal and deposit
+// columns, where exactly one of them is filled in per row.
+func parseDebitCredit(row *Row, debitStr string, creditStr string, decimalSeparator rune) {
+	var debit, credit int64
+	if debitStr != "" {
+		amount, err := ParseAmount(debitStr, decimalSeparator)
+		if err != nil {
+			row.addError(fmt.Sprintf("invalid debit %q", debitStr))
+			return
+		}
+		debit = int64(amount)
+	}
+	if creditStr != "" {
+		amount, err := ParseAmount(creditStr, decimalSeparator)
+		if err != nil {
+			row.addError(fmt.Sprintf("invalid credit %q", creditStr))
+			return
+		}
+		credit = int64(amount)
+	}
+
+	if debit != 0 && credit != 0 {
+		row.addError("row has both a debit and a credit")
+		return
+	}
+	if debit < 0 {
+		debit = -debit
+	}
+	if credit < 0 {
+		credit = -credit
+	}
+	row.setSignedAmount(store.Money(credit - debit))
+}
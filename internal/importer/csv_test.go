@@ -0,0 +1,195 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/KartikSindura/money/internal/store"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in        string
+		separator rune
+		want      store.Money
+		wantErr   bool
+	}{
+		{in: "12.50", separator: '.', want: 1250},
+		{in: "$1,234.56", separator: '.', want: 123456},
+		{in: "1,234,567.00", separator: '.', want: 123456700},
+		{in: "(12.00)", separator: '.', want: -1200},
+		{in: "12.00-", separator: '.', want: -1200},
+		{in: "-7", separator: '.', want: -700},
+		{in: "12,50", separator: ',', want: 1250},
+		{in: "1.234,56 €", separator: ',', want: 123456},
+		{in: "-0,05", separator: ',', want: -5},
+		{in: "12,50", separator: '.', wantErr: true},
+		{in: "1,23.00", separator: '.', wantErr: true},
+		{in: "1.234.5", separator: ',', wantErr: true},
+		{in: "", separator: '.', wantErr: true},
+		{in: "abc", separator: '.', wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.in, tt.separator)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseAmount(%q, %q) = %v, want error", tt.in, tt.separator, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseAmount(%q, %q) error: %v", tt.in, tt.separator, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseAmount(%q, %q) = %d, want %d", tt.in, tt.separator, got, tt.want)
+		}
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	type want struct {
+		date        string
+		kind        string
+		amount      store.Money
+		description string
+		errors      int
+	}
+	tests := []struct {
+		name    string
+		input   string
+		mapping CSVMapping
+		want    []want
+	}{
+		{
+			name:  "signed amount",
+			input: "Date,Amount,Description\n2024-01-31,-12.50,Coffee\n2024-02-01,1000.00,Salary\n",
+			mapping: CSVMapping{
+				DateColumn: "date", AmountColumn: "amount", DescriptionColumn: "description",
+			},
+			want: []want{
+				{date: "2024-01-31", kind: "expense", amount: 1250, description: "Coffee"},
+				{date: "2024-02-01", kind: "income", amount: 100000, description: "Salary"},
+			},
+		},
+		{
+			name:  "comma decimals",
+			input: "Datum;Betrag;Text\n31.01.2024;-12,50;Kaffee\n01.02.2024;1.000,00;Gehalt\n",
+			mapping: CSVMapping{
+				DateColumn: "Datum", DateFormat: "DD.MM.YYYY", AmountColumn: "Betrag",
+				DescriptionColumn: "Text", Delimiter: ";", DecimalSeparator: ",",
+			},
+			want: []want{
+				{date: "2024-01-31", kind: "expense", amount: 1250, description: "Kaffee"},
+				{date: "2024-02-01", kind: "income", amount: 100000, description: "Gehalt"},
+			},
+		},
+		{
+			name:  "comma decimals without decimal_separator",
+			input: "Date;Amount\n2024-01-31;-12,50\n",
+			mapping: CSVMapping{
+				DateColumn: "date", AmountColumn: "amount", Delimiter: ";",
+			},
+			want: []want{
+				{date: "2024-01-31", errors: 1},
+			},
+		},
+		{
+			name:  "debit and credit columns",
+			input: "Date,Withdrawal,Deposit,Memo\n2024-01-31,12.50,,Coffee\n2024-02-01,,\"1,000.00\",Salary\n2024-02-02,1.00,2.00,Both\n",
+			mapping: CSVMapping{
+				DateColumn: "date", DebitColumn: "withdrawal", CreditColumn: "deposit", DescriptionColumn: "memo",
+			},
+			want: []want{
+				{date: "2024-01-31", kind: "expense", amount: 1250, description: "Coffee"},
+				{date: "2024-02-01", kind: "income", amount: 100000, description: "Salary"},
+				{date: "2024-02-02", description: "Both", errors: 1},
+			},
+		},
+		{
+			name:  "skip rows",
+			input: "Account statement\nExported 2024-02-03\nDate,Amount\n2024-01-31,-3.00\n",
+			mapping: CSVMapping{
+				DateColumn: "date", AmountColumn: "amount", SkipRows: 2,
+			},
+			want: []want{
+				{date: "2024-01-31", kind: "expense", amount: 300},
+			},
+		},
+		{
+			name:  "bom header",
+			input: "\ufeffDate,Amount\n2024-01-31,-3.00\n",
+			mapping: CSVMapping{
+				DateColumn: "date", AmountColumn: "amount",
+			},
+			want: []want{
+				{date: "2024-01-31", kind: "expense", amount: 300},
+			},
+		},
+		{
+			name:  "inverted amount",
+			input: "Date,Amount\n2024-01-31,3.00\n\n",
+			mapping: CSVMapping{
+				DateColumn: "date", AmountColumn: "amount", InvertAmount: true,
+			},
+			want: []want{
+				{date: "2024-01-31", kind: "expense", amount: 300},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.mapping.Validate(); err != nil {
+				t.Fatalf("Validate() error: %v", err)
+			}
+			rows, err := ParseCSV(strings.NewReader(tt.input), tt.mapping)
+			if err != nil {
+				t.Fatalf("ParseCSV() error: %v", err)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("ParseCSV() returned %d rows, want %d", len(rows), len(tt.want))
+			}
+			for i, w := range tt.want {
+				row := rows[i]
+				if len(row.Errors) != w.errors {
+					t.Errorf("row %d errors = %v, want %d", i, row.Errors, w.errors)
+				}
+				if row.Date == nil || row.Date.Format("2006-01-02") != w.date {
+					t.Errorf("row %d date = %v, want %s", i, row.Date, w.date)
+				}
+				if w.errors > 0 {
+					continue
+				}
+				if row.Type != w.kind || row.Amount != w.amount || row.Description != w.description {
+					t.Errorf("row %d = %s %d %q, want %s %d %q", i, row.Type, row.Amount, row.Description, w.kind, w.amount, w.description)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCSVMissingColumn(t *testing.T) {
+	_, err := ParseCSV(strings.NewReader("Date,Amount\n"), CSVMapping{DateColumn: "date", AmountColumn: "value"})
+	if err == nil {
+		t.Error("ParseCSV() with unknown column = nil, want error")
+	}
+}
+
+func TestCSVMappingValidateDecimalSeparator(t *testing.T) {
+	for _, separator := range []string{"", ".", ","} {
+		m := CSVMapping{DateColumn: "date", AmountColumn: "amount", Delimiter: ";", DecimalSeparator: separator}
+		if err := m.Validate(); err != nil {
+			t.Errorf("Validate() with decimal_separator %q error: %v", separator, err)
+		}
+	}
+	for _, m := range []CSVMapping{
+		{DateColumn: "date", AmountColumn: "amount", DecimalSeparator: "'"},
+		{DateColumn: "date", AmountColumn: "amount", Delimiter: ",", DecimalSeparator: ","},
+	} {
+		if err := m.Validate(); err == nil {
+			t.Errorf("Validate() with decimal_separator %q, delimiter %q = nil, want error", m.DecimalSeparator, m.Delimiter)
+		}
+	}
+}
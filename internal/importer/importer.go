@@ -0,0 +1,143 @@
+// Package importer turns bank statement files into normalized rows that can
+// be previewed and then booked as expenses and incomes.
+package importer
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/KartikSindura/money/internal/store"
+)
+
+// Row is one statement line after parsing. Amount is always positive, the
+// sign is carried by Type. Rows with Errors must not be imported.
+type Row struct {
+	Line        int         `json:"line"`
+	Date        *time.Time  `json:"date"`
+	Type        string      `json:"type"` // expense or income
+	Amount      store.Money `json:"amount"`
+	Description string      `json:"description"`
+	Category    string      `json:"category,omitempty"`
+	// stable id from the bank (OFX FITID), used to skip rows imported before
+	ExternalID string   `json:"external_id,omitempty"`
+	Duplicate  bool     `json:"duplicate,omitempty"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+func (r *Row) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+func (r *Row) addError(msg string) {
+	r.Errors = append(r.Errors, msg)
+}
+
+// setSignedAmount books negative amounts as expenses and positive ones as
+// incomes.
+func (r *Row) setSignedAmount(amount store.Money) {
+	switch {
+	case amount < 0:
+		r.Type = "expense"
+		r.Amount = -amount
+	case amount > 0:
+		r.Type = "income"
+		r.Amount = amount
+	default:
+		r.addError("amount is zero")
+	}
+}
+
+// Summary counts the rows of a parsed statement. Duplicates are valid rows
+// that were already imported and will be skipped.
+type Summary struct {
+	Total      int `json:"total"`
+	Valid      int `json:"valid"`
+	Invalid    int `json:"invalid"`
+	Duplicates int `json:"duplicates"`
+}
+
+func Summarize(rows []Row) Summary {
+	summary := Summary{Total: len(rows)}
+	for _, row := range rows {
+		switch {
+		case !row.Valid():
+			summary.Invalid++
+		case row.Duplicate:
+			summary.Duplicates++
+		default:
+			summary.Valid++
+		}
+	}
+	return summary
+}
+
+var errInvalidAmount = errors.New("invalid amount")
+
+// ParseAmount reads amounts the way banks print them: currency symbols and
+// spaces are ignored, and "(12.00)" or "12.00-" are negative.
+// decimalSeparator is '.' or ','; the other one may only separate
+// thousands, so "12,50" with a decimal point is an error instead of 1250.
+func ParseAmount(s string, decimalSeparator rune) (store.Money, error) {
+	thousandsSeparator := ','
+	if decimalSeparator == ',' {
+		thousandsSeparator = '.'
+	}
+	s = strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = s[1 : len(s)-1]
+	}
+	if strings.HasSuffix(s, "-") {
+		negative = true
+		s = strings.TrimSuffix(s, "-")
+	}
+
+	cleaned := strings.Builder{}
+	for _, c := range s {
+		if (c >= '0' && c <= '9') || c == '-' || c == '+' || c == decimalSeparator || c == thousandsSeparator {
+			cleaned.WriteRune(c)
+		}
+	}
+	if cleaned.Len() == 0 {
+		return 0, errInvalidAmount
+	}
+
+	whole, frac, hasDecimal := strings.Cut(cleaned.String(), string(decimalSeparator))
+	groups := strings.Split(whole, string(thousandsSeparator))
+	for _, group := range groups[1:] {
+		if len(group) != 3 {
+			return 0, errInvalidAmount
+		}
+	}
+	number := strings.Join(groups, "")
+	if hasDecimal {
+		number += "." + frac
+	}
+
+	amount, err := store.ParseMoney(number)
+	if err != nil {
+		return 0, errInvalidAmount
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// dateLayout accepts either a Go layout or the usual YYYY/MM/DD tokens, so
+// "DD/MM/YYYY" and "02/01/2006" mean the same thing.
+func dateLayout(format string) string {
+	if format == "" {
+		return "2006-01-02"
+	}
+	replacer := strings.NewReplacer(
+		"YYYY", "2006",
+		"MMM", "Jan",
+		"MM", "01",
+		"DD", "02",
+		"YY", "06",
+	)
+	return replacer.Replace(format)
+}
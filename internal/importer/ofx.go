@@ -0,0 +1,184 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrNotOFX = errors.New("file is not an OFX statement")
+
+// ofxTransaction collects the fields of one <STMTTRN> aggregate and the
+// account of the statement it belongs to.
+type ofxTransaction struct {
+	accountID string
+	fields    map[string]string
+}
+
+// ParseOFX reads OFX 1.x (SGML, where leaf elements are not closed) and
+// OFX 2.x (XML) bank and credit card statements, which includes QFX files.
+// Rows are numbered in the order the transactions appear. ExternalID is
+// the FITID, prefixed with the account id of its statement when it has one,
+// because FITIDs are only unique per account. A file can hold several
+// statements, each with its own account.
+func ParseOFX(r io.Reader) ([]Row, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	body := string(data)
+	start := strings.Index(strings.ToUpper(body), "<OFX>")
+	if start < 0 {
+		return nil, ErrNotOFX
+	}
+
+	var accountID string
+	var transactions []ofxTransaction
+	var current *ofxTransaction
+
+	for _, token := range tokenizeOFX(body[start:]) {
+		switch {
+		case (token.name == "STMTRS" || token.name == "CCSTMTRS") && !token.closing:
+			accountID = ""
+		case token.name == "STMTTRN" && !token.closing:
+			current = &ofxTransaction{accountID: accountID, fields: map[string]string{}}
+		case token.name == "STMTTRN" && token.closing:
+			if current != nil {
+				transactions = append(transactions, *current)
+				current = nil
+			}
+		case token.closing || token.value == "":
+			// aggregates and explicit XML end tags carry no data
+		case current != nil:
+			// the first value wins, so <PAYEE><NAME> does not overwrite <NAME>
+			if _, ok := current.fields[token.name]; !ok {
+				current.fields[token.name] = token.value
+			}
+		case token.name == "ACCTID" && accountID == "":
+			// <BANKACCTFROM> comes before the transactions of its statement
+			accountID = token.value
+		}
+	}
+	// SGML files sometimes end without closing the last transaction
+	if current != nil {
+		transactions = append(transactions, *current)
+	}
+
+	rows := []Row{}
+	for i, transaction := range transactions {
+		rows = append(rows, transaction.row(i+1))
+	}
+	return rows, nil
+}
+
+func (t ofxTransaction) row(line int) Row {
+	row := Row{
+		Line:        line,
+		Description: t.fields["NAME"],
+	}
+	if memo := t.fields["MEMO"]; memo != "" && memo != row.Description {
+		if row.Description == "" {
+			row.Description = memo
+		} else {
+			row.Description += " - " + memo
+		}
+	}
+
+	if fitID := t.fields["FITID"]; fitID != "" {
+		row.ExternalID = fitID
+		if t.accountID != "" {
+			row.ExternalID = t.accountID + ":" + fitID
+		}
+	} else {
+		row.addError("transaction has no FITID")
+	}
+
+	date, err := parseOFXDate(t.fields["DTPOSTED"])
+	if err != nil {
+		row.addError(fmt.Sprintf("invalid date %q", t.fields["DTPOSTED"]))
+	} else {
+		row.Date = &date
+	}
+
+	amountStr := t.fields["TRNAMT"]
+	// some banks use a decimal comma
+	decimalSeparator := '.'
+	if strings.Contains(amountStr, ",") && !strings.Contains(amountStr, ".") {
+		decimalSeparator = ','
+	}
+	amount, err := ParseAmount(amountStr, decimalSeparator)
+	if err != nil {
+		row.addError(fmt.Sprintf("invalid amount %q", t.fields["TRNAMT"]))
+	} else {
+		row.setSignedAmount(amount)
+	}
+	return row
+}
+
+// parseOFXDate reads the date part of YYYYMMDD[HHMMSS[.XXX]][[offset:TZ]].
+// The time of day is dropped, statements only care about the posting date.
+func parseOFXDate(s string) (time.Time, error) {
+	if len(s) < 8 {
+		return time.Time{}, errors.New("date too short")
+	}
+	return time.Parse("20060102", s[:8])
+}
+
+type ofxToken struct {
+	name    string
+	closing bool
+	value   string
+}
+
+// tokenizeOFX splits the body into tags and the text that follows each tag.
+// It does not care whether elements are closed, which is what makes the
+// same code work for SGML and XML.
+func tokenizeOFX(body string) []ofxToken {
+	tokens := []ofxToken{}
+	for {
+		open := strings.IndexByte(body, '<')
+		if open < 0 {
+			return tokens
+		}
+		body = body[open+1:]
+		end := strings.IndexByte(body, '>')
+		if end < 0 {
+			return tokens
+		}
+		tag := strings.TrimSpace(body[:end])
+		body = body[end+1:]
+
+		// skip processing instructions and comments
+		if strings.HasPrefix(tag, "?") || strings.HasPrefix(tag, "!") {
+			continue
+		}
+
+		token := ofxToken{}
+		if strings.HasPrefix(tag, "/") {
+			token.closing = true
+			tag = tag[1:]
+		}
+		// drop attributes and self-closing slashes
+		if i := strings.IndexAny(tag, " \t\r\n/"); i >= 0 {
+			tag = tag[:i]
+		}
+		token.name = strings.ToUpper(tag)
+
+		if !token.closing {
+			text := body
+			if next := strings.IndexByte(body, '<'); next >= 0 {
+				text = body[:next]
+			}
+			token.value = decodeOFXText(strings.TrimSpace(text))
+		}
+		tokens = append(tokens, token)
+	}
+}
+
+var ofxEntities = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&quot;", `"`, "&apos;", "'", "&nbsp;", " ", "&amp;", "&")
+
+func decodeOFXText(s string) string {
+	return ofxEntities.Replace(s)
+}
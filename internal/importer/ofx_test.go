@@ -0,0 +1,193 @@
+package importer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/KartikSindura/money/internal/store"
+)
+
+const sgmlStatement = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<BANKMSGSRSV1>
+<STMTTRNRS>
+<STMTRS>
+<CURDEF>USD
+<BANKACCTFROM>
+<BANKID>123456789
+<ACCTID>1111
+<ACCTTYPE>CHECKING
+</BANKACCTFROM>
+<BANKTRANLIST>
+<DTSTART>20240101
+<DTEND>20240131
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20240115120000.000[-5:EST]
+<TRNAMT>-12.50
+<FITID>A1
+<NAME>Joe&apos;s Diner
+<MEMO>Lunch
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20240131
+<TRNAMT>1000,00
+<FITID>A2
+<NAME>Salary
+</BANKTRANLIST>
+</STMTRS>
+</STMTTRNRS>
+</BANKMSGSRSV1>
+</OFX>
+`
+
+const xmlStatement = `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220"?>
+<OFX>
+  <CREDITCARDMSGSRSV1>
+    <CCSTMTTRNRS>
+      <CCSTMTRS>
+        <CURDEF>EUR</CURDEF>
+        <CCACCTFROM><ACCTID>4444</ACCTID></CCACCTFROM>
+        <BANKTRANLIST>
+          <STMTTRN>
+            <TRNTYPE>DEBIT</TRNTYPE>
+            <DTPOSTED>20240205</DTPOSTED>
+            <TRNAMT>-3.20</TRNAMT>
+            <FITID>X1</FITID>
+            <NAME>Tom &amp; Jerry&apos;s &lt;Cafe&gt;</NAME>
+            <MEMO>Tom &amp; Jerry&apos;s &lt;Cafe&gt;</MEMO>
+          </STMTTRN>
+          <STMTTRN>
+            <TRNTYPE>DEBIT</TRNTYPE>
+            <DTPOSTED>2024</DTPOSTED>
+            <TRNAMT>abc</TRNAMT>
+            <NAME>Broken</NAME>
+          </STMTTRN>
+        </BANKTRANLIST>
+      </CCSTMTRS>
+    </CCSTMTTRNRS>
+  </CREDITCARDMSGSRSV1>
+</OFX>
+`
+
+const multiAccountStatement = `<OFX>
+<BANKMSGSRSV1>
+<STMTTRNRS>
+<STMTRS>
+<BANKACCTFROM><ACCTID>1111</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><DTPOSTED>20240101<TRNAMT>-1.00<FITID>T1<NAME>First</STMTTRN>
+</BANKTRANLIST>
+</STMTRS>
+</STMTTRNRS>
+<STMTTRNRS>
+<STMTRS>
+<BANKACCTFROM><ACCTID>2222</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><DTPOSTED>20240102<TRNAMT>-2.00<FITID>T1<NAME>Second</STMTTRN>
+</BANKTRANLIST>
+</STMTRS>
+</STMTTRNRS>
+</BANKMSGSRSV1>
+<CREDITCARDMSGSRSV1>
+<CCSTMTTRNRS>
+<CCSTMTRS>
+<BANKTRANLIST>
+<STMTTRN><DTPOSTED>20240103<TRNAMT>-3.00<FITID>T1<NAME>No account</STMTTRN>
+</BANKTRANLIST>
+</CCSTMTRS>
+</CCSTMTTRNRS>
+</CREDITCARDMSGSRSV1>
+</OFX>
+`
+
+type wantRow struct {
+	date        string
+	kind        string
+	amount      store.Money
+	description string
+	externalID  string
+	errors      int
+}
+
+func checkRows(t *testing.T, rows []Row, want []wantRow) {
+	t.Helper()
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(want))
+	}
+	for i, w := range want {
+		row := rows[i]
+		if len(row.Errors) != w.errors {
+			t.Errorf("row %d errors = %v, want %d", i, row.Errors, w.errors)
+		}
+		if w.errors > 0 {
+			continue
+		}
+		if row.Date == nil || row.Date.Format("2006-01-02") != w.date {
+			t.Errorf("row %d date = %v, want %s", i, row.Date, w.date)
+		}
+		if row.Type != w.kind || row.Amount != w.amount || row.Description != w.description {
+			t.Errorf("row %d = %s %d %q, want %s %d %q", i, row.Type, row.Amount, row.Description, w.kind, w.amount, w.description)
+		}
+		if row.ExternalID != w.externalID {
+			t.Errorf("row %d external id = %q, want %q", i, row.ExternalID, w.externalID)
+		}
+	}
+}
+
+func TestParseOFX(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []wantRow
+	}{
+		{
+			name:  "sgml",
+			input: sgmlStatement,
+			want: []wantRow{
+				{date: "2024-01-15", kind: "expense", amount: 1250, description: "Joe's Diner - Lunch", externalID: "1111:A1"},
+				{date: "2024-01-31", kind: "income", amount: 100000, description: "Salary", externalID: "1111:A2"},
+			},
+		},
+		{
+			name:  "xml with entities",
+			input: xmlStatement,
+			want: []wantRow{
+				{date: "2024-02-05", kind: "expense", amount: 320, description: "Tom & Jerry's <Cafe>", externalID: "4444:X1"},
+				{errors: 3},
+			},
+		},
+		{
+			name:  "multiple accounts",
+			input: multiAccountStatement,
+			want: []wantRow{
+				{date: "2024-01-01", kind: "expense", amount: 100, description: "First", externalID: "1111:T1"},
+				{date: "2024-01-02", kind: "expense", amount: 200, description: "Second", externalID: "2222:T1"},
+				{date: "2024-01-03", kind: "expense", amount: 300, description: "No account", externalID: "T1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := ParseOFX(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("ParseOFX() error: %v", err)
+			}
+			checkRows(t, rows, tt.want)
+		})
+	}
+}
+
+func TestParseOFXNotOFX(t *testing.T) {
+	_, err := ParseOFX(strings.NewReader("Date,Amount\n2024-01-01,1.00\n"))
+	if !errors.Is(err, ErrNotOFX) {
+		t.Errorf("ParseOFX() error = %v, want %v", err, ErrNotOFX)
+	}
+}
@@ -0,0 +1,144 @@
+package importer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrNotQIF = errors.New("file is not a QIF statement")
+
+// qifDateLayouts are tried in order when no date format is given. QIF files
+// from US software use month first, sometimes with an apostrophe before a
+// two-digit year such as 1/31'24.
+var qifDateLayouts = []string{"1/2/2006", "1/2/06", "2006-01-02", "01-02-2006"}
+
+// ParseQIF reads the transactions of bank, cash and credit card sections.
+// Other sections such as category lists or investments are skipped. QIF has
+// no transaction ids, so rows never carry an ExternalID.
+func ParseQIF(r io.Reader, dateFormat string) ([]Row, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	rows := []Row{}
+	sawHeader := false
+	inTransactions := false
+	fields := map[byte]string{}
+	start := 0
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "!") {
+			sawHeader = true
+			header := strings.ToLower(strings.TrimSpace(text))
+			if strings.HasPrefix(header, "!type:") {
+				switch strings.TrimSpace(strings.TrimPrefix(header, "!type:")) {
+				case "bank", "cash", "ccard", "oth a", "oth l":
+					inTransactions = true
+				default:
+					inTransactions = false
+				}
+			} else if header == "!account" {
+				// account blocks end with ^ like a record and are skipped
+				inTransactions = false
+			}
+			continue
+		}
+		if !sawHeader {
+			return nil, ErrNotQIF
+		}
+
+		if text[0] == '^' {
+			if inTransactions && len(fields) > 0 {
+				rows = append(rows, qifRow(start, fields, dateFormat))
+			}
+			fields = map[byte]string{}
+			continue
+		}
+
+		if len(fields) == 0 {
+			start = line
+		}
+		code := text[0]
+		// split lines (S, E, $) repeat per split, only the first is kept
+		if _, ok := fields[code]; !ok {
+			fields[code] = strings.TrimSpace(text[1:])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !sawHeader {
+		return nil, ErrNotQIF
+	}
+	// tolerate a missing ^ after the last record
+	if inTransactions && len(fields) > 0 {
+		rows = append(rows, qifRow(start, fields, dateFormat))
+	}
+	return rows, nil
+}
+
+func qifRow(line int, fields map[byte]string, dateFormat string) Row {
+	row := Row{
+		Line:        line,
+		Description: fields['P'],
+	}
+	if memo := fields['M']; memo != "" && memo != row.Description {
+		if row.Description == "" {
+			row.Description = memo
+		} else {
+			row.Description += " - " + memo
+		}
+	}
+	// [Account] in the category field marks a transfer, not a category.
+	// "Food:Groceries/Class" names a subcategory and a class; the class is
+	// dropped and the subcategory becomes the path "Food/Groceries".
+	if category := fields['L']; !strings.HasPrefix(category, "[") {
+		category, _, _ = strings.Cut(category, "/")
+		row.Category = strings.ReplaceAll(category, ":", "/")
+	}
+
+	date, err := parseQIFDate(fields['D'], dateFormat)
+	if err != nil {
+		row.addError(fmt.Sprintf("invalid date %q", fields['D']))
+	} else {
+		row.Date = &date
+	}
+
+	amountStr, ok := fields['T']
+	if !ok {
+		amountStr = fields['U']
+	}
+	amount, err := ParseAmount(amountStr, '.')
+	if err != nil {
+		row.addError(fmt.Sprintf("invalid amount %q", amountStr))
+	} else {
+		row.setSignedAmount(amount)
+	}
+	return row
+}
+
+func parseQIFDate(s string, dateFormat string) (time.Time, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), "'", "/")
+	s = strings.ReplaceAll(s, " ", "")
+	if dateFormat != "" {
+		return time.Parse(dateLayout(dateFormat), s)
+	}
+	for _, layout := range qifDateLayouts {
+		date, err := time.Parse(layout, s)
+		if err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, errors.New("unknown date format")
+}
@@ -0,0 +1,72 @@
+package importer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseQIF(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		dateFormat string
+		want       []wantRow
+	}{
+		{
+			name: "bank",
+			input: "\ufeff!Type:Bank\r\n" +
+				"D1/31'24\r\nT-12.50\r\nPJoe's Diner\r\nMLunch\r\nLFood:Restaurants/Business\r\n^\r\n" +
+				"D02/01/2024\r\nU1,000.00\r\nPSalary\r\n^\r\n",
+			want: []wantRow{
+				{date: "2024-01-31", kind: "expense", amount: 1250, description: "Joe's Diner - Lunch"},
+				{date: "2024-02-01", kind: "income", amount: 100000, description: "Salary"},
+			},
+		},
+		{
+			name:       "date format and missing final caret",
+			input:      "!Type:CCard\nD31.01.2024\nT-3.00\nPBakery\n",
+			dateFormat: "DD.MM.YYYY",
+			want: []wantRow{
+				{date: "2024-01-31", kind: "expense", amount: 300, description: "Bakery"},
+			},
+		},
+		{
+			name: "skips other sections",
+			input: "!Type:Cat\nNFood\n^\n" +
+				"!Account\nNChecking\nTBank\n^\n" +
+				"!Type:Bank\nD1/2'24\nT-1.00\nPTransfer\nL[Savings]\n^\nDnot a date\nT2.00\n^\n",
+			want: []wantRow{
+				{date: "2024-01-02", kind: "expense", amount: 100, description: "Transfer"},
+				{errors: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := ParseQIF(strings.NewReader(tt.input), tt.dateFormat)
+			if err != nil {
+				t.Fatalf("ParseQIF() error: %v", err)
+			}
+			checkRows(t, rows, tt.want)
+		})
+	}
+}
+
+func TestParseQIFCategory(t *testing.T) {
+	rows, err := ParseQIF(strings.NewReader("!Type:Bank\nD1/31'24\nT-1.00\nLFood:Groceries/Weekly\n^\nD1/31'24\nT-1.00\nL[Savings]\n^\n"), "")
+	if err != nil {
+		t.Fatalf("ParseQIF() error: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Category != "Food/Groceries" || rows[1].Category != "" {
+		t.Errorf("ParseQIF() categories = %+v, want Food/Groceries and none for the transfer", rows)
+	}
+}
+
+func TestParseQIFNotQIF(t *testing.T) {
+	_, err := ParseQIF(strings.NewReader("Date,Amount\n"), "")
+	if !errors.Is(err, ErrNotQIF) {
+		t.Errorf("ParseQIF() error = %v, want %v", err, ErrNotQIF)
+	}
+}
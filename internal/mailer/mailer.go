@@ -0,0 +1,114 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string // plain text
+}
+
+type Mailer interface {
+	Send(message Message) error
+}
+
+// FromEnv picks the mailer from the environment: SMTP when SMTP_HOST is set,
+// otherwise one that writes the mails to MAIL_DIR, or to the log when that
+// is not set either.
+func FromEnv(logger *log.Logger) Mailer {
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPMailer{
+			Addr:     net.JoinHostPort(host, port),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+	}
+	return &FileMailer{Dir: os.Getenv("MAIL_DIR"), Logger: logger}
+}
+
+// SMTPMailer sends mail through an SMTP server, authenticating when a
+// username is given. net/smtp upgrades to TLS when the server offers it.
+type SMTPMailer struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(message Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, []string{message.To}, format(m.From, message))
+}
+
+// FileMailer is for local development: every mail is written to a file in
+// Dir, or printed to the log when Dir is empty.
+type FileMailer struct {
+	Dir    string
+	Logger *log.Logger
+}
+
+func (m *FileMailer) Send(message Message) error {
+	data := format("", message)
+	if m.Dir == "" {
+		m.Logger.Printf("mail:\n%s", data)
+		return nil
+	}
+
+	err := os.MkdirAll(m.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), sanitize(message.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), data, 0o600)
+}
+
+// format builds the RFC 5322 text of a message. Header values come from our
+// own code and the user's validated email, but new lines are dropped anyway
+// so a header cannot be injected.
+func format(from string, message Message) []byte {
+	header := func(value string) string {
+		return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+	}
+
+	var b strings.Builder
+	if from != "" {
+		fmt.Fprintf(&b, "From: %s\r\n", header(from))
+	}
+	fmt.Fprintf(&b, "To: %s\r\n", header(message.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", header(message.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
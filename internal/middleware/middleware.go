@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"log"
 	"net/http"
 	"strings"
 
@@ -10,12 +11,17 @@ import (
 )
 
 type UserMiddleware struct {
-	UserStore store.UserStore
+	UserStore    store.UserStore
+	SessionStore store.SessionStore
+	APIKeyStore  store.APIKeyStore
+	Logger       *log.Logger
 }
 
 type contextKey string
 
 const UserContextKey = contextKey("user")
+const SessionContextKey = contextKey("session")
+const APIKeyContextKey = contextKey("api_key")
 
 func SetUser(r *http.Request, user *store.User) *http.Request {
 	ctx := context.WithValue(r.Context(), UserContextKey, user)
@@ -30,6 +36,19 @@ func GetUser(r *http.Request) *store.User {
 	return user
 }
 
+// GetSessionID returns the session the request's access token belongs to.
+func GetSessionID(r *http.Request) int64 {
+	sessionID, _ := r.Context().Value(SessionContextKey).(int64)
+	return sessionID
+}
+
+// GetAPIKey returns the API key the request was made with, or nil for
+// requests made with an access token.
+func GetAPIKey(r *http.Request) *store.APIKey {
+	apiKey, _ := r.Context().Value(APIKeyContextKey).(*store.APIKey)
+	return apiKey
+}
+
 func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
@@ -40,12 +59,24 @@ func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		if strings.HasPrefix(tokenString, store.APIKeyPrefix) {
+			um.authenticateAPIKey(w, r, tokenString, next)
+			return
+		}
+
 		claims, err := utils.ValidateJWT(tokenString)
 		if err != nil {
 			next.ServeHTTP(w, r)
 			return
 		}
 
+		// tokens stop working as soon as their session is revoked
+		active, err := um.SessionStore.IsSessionActive(claims.SessionID, claims.UserID)
+		if err != nil || !active {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		user, err := um.UserStore.GetUserByID(claims.UserID)
 		if err != nil {
 			next.ServeHTTP(w, r)
@@ -53,17 +84,62 @@ func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 		}
 
 		ctx := context.WithValue(r.Context(), UserContextKey, user)
+		ctx = context.WithValue(ctx, SessionContextKey, claims.SessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// authenticateAPIKey is Authenticate for requests made with an API key
+// instead of an access token.
+func (um *UserMiddleware) authenticateAPIKey(w http.ResponseWriter, r *http.Request, key string, next http.Handler) {
+	apiKey, err := um.APIKeyStore.GetAPIKeyByHash(store.HashToken(key))
+	if err != nil || apiKey.Expired() {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	user, err := um.UserStore.GetUserByID(apiKey.UserID)
+	if err != nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	err = um.APIKeyStore.TouchAPIKey(apiKey.ID)
+	if err != nil {
+		um.Logger.Printf("ERROR: TouchAPIKey: %v", err)
+	}
+
+	ctx := context.WithValue(r.Context(), UserContextKey, user)
+	ctx = context.WithValue(ctx, APIKeyContextKey, apiKey)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RequireUser lets only logged-in users through. API keys are refused, they
+// only reach routes wrapped in RequireScope.
 func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
+	return um.RequireScope("", next)
+}
+
+// RequireScope is RequireUser for routes API keys may use as well, when
+// they were given scope. Users logged in with an access token may do
+// everything.
+func (um *UserMiddleware) RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user, ok := r.Context().Value(UserContextKey).(*store.User)
 		if !ok || user == nil {
 			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
 			return
 		}
+		if apiKey := GetAPIKey(r); apiKey != nil {
+			if scope == "" {
+				utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "not available with an api key"})
+				return
+			}
+			if !apiKey.HasScope(scope) {
+				utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "api key lacks the " + scope + " scope"})
+				return
+			}
+		}
 		next(w, r)
 	}
 }
@@ -0,0 +1,72 @@
+package recurring
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/KartikSindura/money/internal/store"
+)
+
+// Worker periodically turns due recurring rules into expenses and incomes.
+// It runs once on start, so occurrences missed while the server was down are
+// caught up immediately.
+type Worker struct {
+	recurringStore store.RecurringStore
+	interval       time.Duration
+	logger         *log.Logger
+	quit           chan struct{}
+	wg             sync.WaitGroup
+}
+
+func NewWorker(recurringStore store.RecurringStore, interval time.Duration, logger *log.Logger) *Worker {
+	return &Worker{
+		recurringStore: recurringStore,
+		interval:       interval,
+		logger:         logger,
+		quit:           make(chan struct{}),
+	}
+}
+
+func (w *Worker) Start() {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			w.RunOnce(time.Now())
+			select {
+			case <-ticker.C:
+			case <-w.quit:
+				return
+			}
+		}
+	}()
+}
+
+func (w *Worker) Stop() {
+	close(w.quit)
+	w.wg.Wait()
+}
+
+// RunOnce materializes every rule that is due at now. A failing rule is
+// logged and retried on the next run without blocking the others.
+func (w *Worker) RunOnce(now time.Time) {
+	ids, err := w.recurringStore.GetDueRecurringRuleIDs(now)
+	if err != nil {
+		w.logger.Printf("Error: recurring worker: %v", err)
+		return
+	}
+	for _, id := range ids {
+		created, err := w.recurringStore.MaterializeRecurringRule(id, now)
+		if err != nil {
+			w.logger.Printf("Error: recurring worker: rule %d: %v", id, err)
+			continue
+		}
+		if created > 0 {
+			w.logger.Printf("recurring worker: rule %d posted %d transaction(s)", id, created)
+		}
+	}
+}
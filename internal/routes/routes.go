@@ -2,6 +2,7 @@ package routes
 
 import (
 	"github.com/KartikSindura/money/internal/app"
+	"github.com/KartikSindura/money/internal/store"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -10,30 +11,88 @@ func SetupRoutes(app *app.Application) *chi.Mux {
 	r.Group(func(r chi.Router) {
 		r.Use(app.Middleware.Authenticate)
 
-		r.Post("/expenses", app.Middleware.RequireUser(app.TransactionHandler.HandleCreateExpense))
-		r.Get("/expenses/{id}", app.Middleware.RequireUser(app.TransactionHandler.HandleGetExpenseByID))
-		r.Put("/expenses/{id}", app.Middleware.RequireUser(app.TransactionHandler.HandleUpdateExpense))
-		r.Delete("/expenses/{id}", app.Middleware.RequireUser(app.TransactionHandler.HandleDeleteExpense))
-		r.Get("/expenses", app.Middleware.RequireUser(app.TransactionHandler.HandleGetExpenses))
-		r.Get("/total-expenses", app.Middleware.RequireUser(app.TransactionHandler.HandleGetTotalExpenses))
-		r.Post("/incomes", app.Middleware.RequireUser(app.TransactionHandler.HandleCreateIncome))
-		r.Get("/incomes/{id}", app.Middleware.RequireUser(app.TransactionHandler.HandleGetIncomeByID))
-		r.Put("/incomes/{id}", app.Middleware.RequireUser(app.TransactionHandler.HandleUpdateIncome))
-		r.Delete("/incomes/{id}", app.Middleware.RequireUser(app.TransactionHandler.HandleDeleteIncome))
-		r.Get("/incomes", app.Middleware.RequireUser(app.TransactionHandler.HandleGetIncomes))
-		r.Get("/total-incomes", app.Middleware.RequireUser(app.TransactionHandler.HandleGetTotalIncomes))
-		r.Get("/transactions", app.Middleware.RequireUser(app.TransactionHandler.HandleGetTransactions))
-		r.Get("/categories", app.Middleware.RequireUser(app.TransactionHandler.HandleGetCategories))
+		r.Post("/expenses", app.Middleware.RequireScope(store.ScopeTransactionsWrite, app.TransactionHandler.HandleCreateExpense))
+		r.Get("/expenses/{id}", app.Middleware.RequireScope(store.ScopeTransactionsRead, app.TransactionHandler.HandleGetExpenseByID))
+		r.Put("/expenses/{id}", app.Middleware.RequireScope(store.ScopeTransactionsWrite, app.TransactionHandler.HandleUpdateExpense))
+		r.Delete("/expenses/{id}", app.Middleware.RequireScope(store.ScopeTransactionsWrite, app.TransactionHandler.HandleDeleteExpense))
+		r.Get("/expenses", app.Middleware.RequireScope(store.ScopeTransactionsRead, app.TransactionHandler.HandleGetExpenses))
+		r.Get("/total-expenses", app.Middleware.RequireScope(store.ScopeTransactionsRead, app.TransactionHandler.HandleGetTotalExpenses))
+		r.Post("/incomes", app.Middleware.RequireScope(store.ScopeTransactionsWrite, app.TransactionHandler.HandleCreateIncome))
+		r.Get("/incomes/{id}", app.Middleware.RequireScope(store.ScopeTransactionsRead, app.TransactionHandler.HandleGetIncomeByID))
+		r.Put("/incomes/{id}", app.Middleware.RequireScope(store.ScopeTransactionsWrite, app.TransactionHandler.HandleUpdateIncome))
+		r.Delete("/incomes/{id}", app.Middleware.RequireScope(store.ScopeTransactionsWrite, app.TransactionHandler.HandleDeleteIncome))
+		r.Get("/incomes", app.Middleware.RequireScope(store.ScopeTransactionsRead, app.TransactionHandler.HandleGetIncomes))
+		r.Get("/total-incomes", app.Middleware.RequireScope(store.ScopeTransactionsRead, app.TransactionHandler.HandleGetTotalIncomes))
+		r.Get("/transactions", app.Middleware.RequireScope(store.ScopeTransactionsRead, app.TransactionHandler.HandleGetTransactions))
+		r.Get("/transactions/duplicates", app.Middleware.RequireScope(store.ScopeTransactionsRead, app.TransactionHandler.HandleGetDuplicates))
+		r.Get("/export", app.Middleware.RequireScope(store.ScopeTransactionsRead, app.TransactionHandler.HandleExport))
+		r.Post("/imports", app.Middleware.RequireScope(store.ScopeTransactionsWrite, app.TransactionHandler.HandleImportCSV))
+		r.Post("/imports/statement", app.Middleware.RequireScope(store.ScopeTransactionsWrite, app.TransactionHandler.HandleImportStatement))
+		r.Get("/categories", app.Middleware.RequireScope(store.ScopeTransactionsRead, app.CategoryHandler.HandleGetCategories))
+		r.Post("/categories", app.Middleware.RequireUser(app.CategoryHandler.HandleCreateCategory))
+		r.Get("/categories/suggest", app.Middleware.RequireScope(store.ScopeTransactionsRead, app.CategoryHandler.HandleSuggestCategories))
+		r.Get("/categories/{id}", app.Middleware.RequireScope(store.ScopeTransactionsRead, app.CategoryHandler.HandleGetCategoryByID))
+		r.Put("/categories/{id}", app.Middleware.RequireUser(app.CategoryHandler.HandleUpdateCategory))
+		r.Delete("/categories/{id}", app.Middleware.RequireUser(app.CategoryHandler.HandleDeleteCategory))
+		r.Post("/categories/{id}/move", app.Middleware.RequireUser(app.CategoryHandler.HandleMoveCategory))
+		r.Post("/categories/{id}/merge", app.Middleware.RequireUser(app.CategoryHandler.HandleMergeCategory))
+		r.Get("/tags", app.Middleware.RequireScope(store.ScopeTransactionsRead, app.TagHandler.HandleGetTags))
+		r.Get("/payees", app.Middleware.RequireScope(store.ScopeTransactionsRead, app.PayeeHandler.HandleGetPayees))
+		r.Get("/payees/{id}/summary", app.Middleware.RequireScope(store.ScopeReportsRead, app.PayeeHandler.HandleGetPayeeSummary))
+		r.Post("/rules", app.Middleware.RequireUser(app.RuleHandler.HandleCreateRule))
+		r.Get("/rules", app.Middleware.RequireUser(app.RuleHandler.HandleGetRules))
+		r.Post("/rules/apply", app.Middleware.RequireUser(app.RuleHandler.HandleApplyRules))
+		r.Get("/rules/{id}", app.Middleware.RequireUser(app.RuleHandler.HandleGetRuleByID))
+		r.Put("/rules/{id}", app.Middleware.RequireUser(app.RuleHandler.HandleUpdateRule))
+		r.Delete("/rules/{id}", app.Middleware.RequireUser(app.RuleHandler.HandleDeleteRule))
+		r.Put("/users/me", app.Middleware.RequireUser(app.UserHandler.HandleUpdateCurrentUser))
+		r.Post("/logout", app.Middleware.RequireUser(app.UserHandler.HandleLogout))
+		r.Post("/logout-all", app.Middleware.RequireUser(app.UserHandler.HandleLogoutAll))
+		r.Get("/sessions", app.Middleware.RequireUser(app.SessionHandler.HandleGetSessions))
+		r.Delete("/sessions/{id}", app.Middleware.RequireUser(app.SessionHandler.HandleDeleteSession))
+		r.Get("/2fa", app.Middleware.RequireUser(app.TwoFactorHandler.HandleGetTwoFactor))
+		r.Post("/2fa/setup", app.Middleware.RequireUser(app.TwoFactorHandler.HandleSetupTwoFactor))
+		r.Post("/2fa/confirm", app.Middleware.RequireUser(app.TwoFactorHandler.HandleConfirmTwoFactor))
+		r.Post("/2fa/recovery-codes", app.Middleware.RequireUser(app.TwoFactorHandler.HandleRegenerateRecoveryCodes))
+		r.Post("/2fa/disable", app.Middleware.RequireUser(app.TwoFactorHandler.HandleDisableTwoFactor))
+		r.Post("/api-keys", app.Middleware.RequireUser(app.APIKeyHandler.HandleCreateAPIKey))
+		r.Get("/api-keys", app.Middleware.RequireUser(app.APIKeyHandler.HandleGetAPIKeys))
+		r.Delete("/api-keys/{id}", app.Middleware.RequireUser(app.APIKeyHandler.HandleDeleteAPIKey))
+		r.Post("/recurring", app.Middleware.RequireUser(app.RecurringHandler.HandleCreateRecurringRule))
+		r.Get("/recurring/{id}", app.Middleware.RequireUser(app.RecurringHandler.HandleGetRecurringRuleByID))
+		r.Put("/recurring/{id}", app.Middleware.RequireUser(app.RecurringHandler.HandleUpdateRecurringRule))
+		r.Delete("/recurring/{id}", app.Middleware.RequireUser(app.RecurringHandler.HandleDeleteRecurringRule))
+		r.Get("/recurring", app.Middleware.RequireUser(app.RecurringHandler.HandleGetRecurringRules))
+		r.Post("/budgets", app.Middleware.RequireUser(app.BudgetHandler.HandleSetBudget))
+		r.Get("/budgets", app.Middleware.RequireUser(app.BudgetHandler.HandleGetBudgets))
+		r.Get("/budgets/{month}", app.Middleware.RequireScope(store.ScopeReportsRead, app.BudgetHandler.HandleGetBudgetReport))
+		r.Put("/budgets/{id}", app.Middleware.RequireUser(app.BudgetHandler.HandleUpdateBudget))
+		r.Delete("/budgets/{id}", app.Middleware.RequireUser(app.BudgetHandler.HandleDeleteBudget))
+		r.Post("/accounts", app.Middleware.RequireUser(app.AccountHandler.HandleCreateAccount))
+		r.Get("/accounts/{id}", app.Middleware.RequireScope(store.ScopeTransactionsRead, app.AccountHandler.HandleGetAccountByID))
+		r.Put("/accounts/{id}", app.Middleware.RequireUser(app.AccountHandler.HandleUpdateAccount))
+		r.Delete("/accounts/{id}", app.Middleware.RequireUser(app.AccountHandler.HandleDeleteAccount))
+		r.Get("/accounts", app.Middleware.RequireScope(store.ScopeTransactionsRead, app.AccountHandler.HandleGetAccounts))
+		r.Post("/transfers", app.Middleware.RequireScope(store.ScopeTransactionsWrite, app.TransferHandler.HandleCreateTransfer))
+		r.Get("/transfers/{id}", app.Middleware.RequireScope(store.ScopeTransactionsRead, app.TransferHandler.HandleGetTransferByID))
+		r.Put("/transfers/{id}", app.Middleware.RequireScope(store.ScopeTransactionsWrite, app.TransferHandler.HandleUpdateTransfer))
+		r.Delete("/transfers/{id}", app.Middleware.RequireScope(store.ScopeTransactionsWrite, app.TransferHandler.HandleDeleteTransfer))
+		r.Get("/transfers", app.Middleware.RequireScope(store.ScopeTransactionsRead, app.TransferHandler.HandleGetTransfers))
+		r.Get("/reports/summary", app.Middleware.RequireScope(store.ScopeReportsRead, app.ReportHandler.HandleGetSummaryReport))
+		r.Get("/reports/categories", app.Middleware.RequireScope(store.ScopeReportsRead, app.ReportHandler.HandleGetCategoryReport))
+		r.Get("/reports/tags", app.Middleware.RequireScope(store.ScopeReportsRead, app.ReportHandler.HandleGetTagReport))
 	})
 
 	r.Get("/health", app.HealthCheck)
 
 	r.Post("/register", app.UserHandler.HandleRegisterUser)
 	r.Post("/login", app.UserHandler.HandleLoginUser)
-	// TODO: total expenses filtered by month
-	// TODO: total incomes filtered by month
-	// TODO: recurring transactions
-	// TODO: budgeting
+	r.Post("/login/2fa", app.UserHandler.HandleLoginTwoFactor)
+	r.Post("/auth/refresh", app.UserHandler.HandleRefreshToken)
+	r.Post("/password/forgot", app.UserHandler.HandleForgotPassword)
+	r.Post("/password/reset", app.UserHandler.HandleResetPassword)
+	r.Post("/email/verify", app.UserHandler.HandleVerifyEmail)
+	r.Post("/email/verify/resend", app.UserHandler.HandleResendVerification)
 
 	return r
 }
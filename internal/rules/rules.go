@@ -0,0 +1,74 @@
+package rules
+
+import (
+	"strings"
+
+	"github.com/KartikSindura/money/internal/store"
+)
+
+// Transaction is what rules look at: a new expense or income, or a stored
+// one when the rules are re-run.
+type Transaction struct {
+	Type      string // expense or income
+	Note      string
+	Payee     *string
+	Amount    store.Money
+	AccountID *int64
+}
+
+// Result is what the matching rules ask for. Category and Payee come from
+// the first matching rule that sets them; tags from all of them.
+type Result struct {
+	Category *string
+	Payee    *string
+	Tags     []string
+	RuleIDs  []int64
+}
+
+// Matches reports whether every condition of the rule holds.
+func Matches(rule *store.Rule, t Transaction) bool {
+	c := rule.Conditions
+	if c.Type != nil && *c.Type != t.Type {
+		return false
+	}
+	if c.NoteContains != nil && !contains(t.Note, *c.NoteContains) {
+		return false
+	}
+	if c.PayeeContains != nil && (t.Payee == nil || !contains(*t.Payee, *c.PayeeContains)) {
+		return false
+	}
+	if c.MinAmount != nil && t.Amount < *c.MinAmount {
+		return false
+	}
+	if c.MaxAmount != nil && t.Amount > *c.MaxAmount {
+		return false
+	}
+	if c.AccountID != nil && (t.AccountID == nil || *t.AccountID != *c.AccountID) {
+		return false
+	}
+	return true
+}
+
+// Apply runs the enabled rules, which must be in priority order, over t.
+func Apply(rules []store.Rule, t Transaction) Result {
+	result := Result{}
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Enabled || !Matches(rule, t) {
+			continue
+		}
+		result.RuleIDs = append(result.RuleIDs, rule.ID)
+		if result.Category == nil {
+			result.Category = rule.Actions.SetCategory
+		}
+		if result.Payee == nil {
+			result.Payee = rule.Actions.SetPayee
+		}
+		result.Tags = append(result.Tags, rule.Actions.AddTags...)
+	}
+	return result
+}
+
+func contains(s string, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
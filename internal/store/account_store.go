@@ -0,0 +1,164 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrAccountInUse = errors.New("account still has transactions or recurring rules")
+
+type Account struct {
+	ID             int64     `json:"id"`
+	UserID         int64     `json:"user_id"`
+	Name           string    `json:"name"`
+	Type           string    `json:"type"` // cash, bank, credit or loan
+	OpeningBalance Money     `json:"opening_balance"`
+	Currency       string    `json:"currency"`
+	Balance        Money     `json:"balance"` // opening balance plus incomes and transfers in, minus expenses and transfers out
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type PostgresAccountStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAccountStore(db *sql.DB) *PostgresAccountStore {
+	return &PostgresAccountStore{
+		db: db,
+	}
+}
+
+type AccountStore interface {
+	CreateAccount(account *Account) (*Account, error)
+	GetAccountByID(id int64) (*Account, error)
+	GetAccounts(user_id int64) ([]Account, error)
+	UpdateAccount(account *Account) error
+	DeleteAccountByID(id int64) error
+}
+
+// balances are computed live so they can never drift from the transactions
+const accountColumns = `a.id, a.user_id, a.name, a.type, a.opening_balance, a.currency,
+	a.opening_balance
+	+ COALESCE((SELECT SUM(amount) FROM incomes WHERE account_id = a.id), 0)
+	- COALESCE((SELECT SUM(amount) FROM expenses WHERE account_id = a.id), 0)
+	+ COALESCE((SELECT SUM(amount) FROM transfers WHERE to_account_id = a.id), 0)
+	- COALESCE((SELECT SUM(amount) FROM transfers WHERE from_account_id = a.id), 0) AS balance,
+	a.created_at, a.updated_at`
+
+func scanAccount(row rowScanner, account *Account) error {
+	return row.Scan(&account.ID, &account.UserID, &account.Name, &account.Type, &account.OpeningBalance, &account.Currency,
+		&account.Balance, &account.CreatedAt, &account.UpdatedAt)
+}
+
+func (pg *PostgresAccountStore) CreateAccount(account *Account) (*Account, error) {
+	query := `
+	INSERT INTO accounts (user_id, name, type, opening_balance, currency)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at, updated_at
+	`
+	err := pg.db.QueryRow(query, account.UserID, account.Name, account.Type, account.OpeningBalance, account.Currency).Scan(&account.ID, &account.CreatedAt, &account.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	account.Balance = account.OpeningBalance
+	return account, nil
+}
+
+func (pg *PostgresAccountStore) GetAccountByID(id int64) (*Account, error) {
+	account := &Account{}
+	query := `SELECT ` + accountColumns + `
+	FROM accounts a
+	WHERE a.id = $1
+	`
+	err := scanAccount(pg.db.QueryRow(query, id), account)
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (pg *PostgresAccountStore) GetAccounts(user_id int64) ([]Account, error) {
+	query := `SELECT ` + accountColumns + `
+	FROM accounts a
+	WHERE a.user_id = $1
+	ORDER BY a.name
+	`
+	rows, err := pg.db.Query(query, user_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []Account{}
+	for rows.Next() {
+		account := Account{}
+		err := scanAccount(rows, &account)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+func (pg *PostgresAccountStore) UpdateAccount(account *Account) error {
+	query := `
+	UPDATE accounts
+	SET name = $1, type = $2, opening_balance = $3, updated_at = $4
+	WHERE id = $5
+	`
+	result, err := pg.db.Exec(query, account.Name, account.Type, account.OpeningBalance, account.UpdatedAt, account.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteAccountByID refuses to delete an account that transactions or
+// recurring rules still point at and returns ErrAccountInUse instead.
+func (pg *PostgresAccountStore) DeleteAccountByID(id int64) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inUse bool
+	query := `
+	SELECT EXISTS (SELECT 1 FROM expenses WHERE account_id = $1)
+	OR EXISTS (SELECT 1 FROM recurring_rules WHERE account_id = $1)
+	OR EXISTS (SELECT 1 FROM incomes WHERE account_id = $1)
+	OR EXISTS (SELECT 1 FROM transfers WHERE from_account_id = $1 OR to_account_id = $1)
+	`
+	err = tx.QueryRow(query, id).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrAccountInUse
+	}
+
+	result, err := tx.Exec(`DELETE FROM accounts WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// APIKeyPrefix starts every API key, telling them apart from access tokens.
+const APIKeyPrefix = "mm_"
+
+// Scopes an API key can be given. Keys reach only the routes that ask for
+// one of their scopes.
+const (
+	ScopeTransactionsRead  = "transactions:read"
+	ScopeTransactionsWrite = "transactions:write"
+	ScopeReportsRead       = "reports:read"
+)
+
+var APIKeyScopes = []string{ScopeTransactionsRead, ScopeTransactionsWrite, ScopeReportsRead}
+
+type ScopeList []string
+
+func (s *ScopeList) Scan(src any) error {
+	*s = ScopeList{}
+	return scanJSON(src, s)
+}
+
+func (s ScopeList) Value() (driver.Value, error) {
+	if s == nil {
+		s = ScopeList{}
+	}
+	return json.Marshal(s)
+}
+
+// APIKey lets scripts use the API without a password. The key itself is
+// only known when it is created.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // first characters of the key
+	Scopes     ScopeList  `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+func (k *APIKey) Expired() bool {
+	return k.ExpiresAt != nil && !k.ExpiresAt.After(time.Now())
+}
+
+// NewAPIKey returns a random key like mm_1a2b3c4d_<secret>, the prefix
+// shown for it and the hash that is stored.
+func NewAPIKey() (string, string, []byte, error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	_, err := rand.Read(id)
+	if err == nil {
+		_, err = rand.Read(secret)
+	}
+	if err != nil {
+		return "", "", nil, err
+	}
+	prefix := APIKeyPrefix + hex.EncodeToString(id)
+	key := prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, HashToken(key), nil
+}
+
+type PostgresAPIKeyStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAPIKeyStore(db *sql.DB) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{
+		db: db,
+	}
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(apiKey *APIKey, keyHash []byte) (*APIKey, error)
+	GetAPIKeyByID(id int64) (*APIKey, error)
+	GetAPIKeyByHash(keyHash []byte) (*APIKey, error)
+	GetAPIKeys(user_id int64) ([]APIKey, error)
+	TouchAPIKey(id int64) error
+	DeleteAPIKeyByID(id int64) error
+}
+
+const apiKeyColumns = `id, user_id, name, prefix, scopes, expires_at, last_used_at, created_at, updated_at`
+
+func scanAPIKey(row rowScanner, apiKey *APIKey) error {
+	return row.Scan(&apiKey.ID, &apiKey.UserID, &apiKey.Name, &apiKey.Prefix, &apiKey.Scopes, &apiKey.ExpiresAt, &apiKey.LastUsedAt, &apiKey.CreatedAt, &apiKey.UpdatedAt)
+}
+
+func (pg *PostgresAPIKeyStore) CreateAPIKey(apiKey *APIKey, keyHash []byte) (*APIKey, error) {
+	query := `
+	INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at, updated_at
+	`
+	err := pg.db.QueryRow(query, apiKey.UserID, apiKey.Name, apiKey.Prefix, keyHash, apiKey.Scopes, apiKey.ExpiresAt).Scan(&apiKey.ID, &apiKey.CreatedAt, &apiKey.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return apiKey, nil
+}
+
+func (pg *PostgresAPIKeyStore) GetAPIKeyByID(id int64) (*APIKey, error) {
+	apiKey := &APIKey{}
+	query := `SELECT ` + apiKeyColumns + `
+	FROM api_keys
+	WHERE id = $1
+	`
+	err := scanAPIKey(pg.db.QueryRow(query, id), apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return apiKey, nil
+}
+
+// GetAPIKeyByHash finds the key a request was made with. Expired keys are
+// returned too; callers check Expired.
+func (pg *PostgresAPIKeyStore) GetAPIKeyByHash(keyHash []byte) (*APIKey, error) {
+	apiKey := &APIKey{}
+	query := `SELECT ` + apiKeyColumns + `
+	FROM api_keys
+	WHERE key_hash = $1
+	`
+	err := scanAPIKey(pg.db.QueryRow(query, keyHash), apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return apiKey, nil
+}
+
+func (pg *PostgresAPIKeyStore) GetAPIKeys(user_id int64) ([]APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + `
+	FROM api_keys
+	WHERE user_id = $1
+	ORDER BY created_at DESC, id DESC
+	`
+	rows, err := pg.db.Query(query, user_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	apiKeys := []APIKey{}
+	for rows.Next() {
+		var apiKey APIKey
+		err := scanAPIKey(rows, &apiKey)
+		if err != nil {
+			return nil, err
+		}
+		apiKeys = append(apiKeys, apiKey)
+	}
+	return apiKeys, rows.Err()
+}
+
+// TouchAPIKey records that the key was just used. A script making many
+// requests only causes a write about once a minute.
+func (pg *PostgresAPIKeyStore) TouchAPIKey(id int64) error {
+	query := `
+	UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')
+	`
+	_, err := pg.db.Exec(query, id)
+	return err
+}
+
+func (pg *PostgresAPIKeyStore) DeleteAPIKeyByID(id int64) error {
+	result, err := pg.db.Exec(`DELETE FROM api_keys WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
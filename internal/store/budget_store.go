@@ -0,0 +1,239 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+type Budget struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	CategoryID int64     `json:"category_id"`
+	Category   *string   `json:"category,omitempty"`
+	Month      string    `json:"month"` // YYYY-MM
+	Amount     Money     `json:"amount"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type BudgetReportLine struct {
+	BudgetID    *int64   `json:"budget_id,omitempty"`
+	CategoryID  int64    `json:"category_id"`
+	Category    string   `json:"category"`
+	Limit       *Money   `json:"limit,omitempty"`
+	Spent       Money    `json:"spent"`
+	Remaining   *Money   `json:"remaining,omitempty"`
+	PercentUsed *float64 `json:"percent_used,omitempty"`
+}
+
+type BudgetReport struct {
+	Month      string             `json:"month"`
+	Budgets    []BudgetReportLine `json:"budgets"`
+	TotalLimit Money              `json:"total_limit"` // over budgets not nested under another budget
+	TotalSpent Money              `json:"total_spent"` // likewise, so no expense is counted twice
+	// spending in categories that have no limit for the month
+	Unbudgeted struct {
+		Spent      Money              `json:"spent"`
+		Categories []BudgetReportLine `json:"categories"`
+	} `json:"unbudgeted"`
+}
+
+type PostgresBudgetStore struct {
+	db *sql.DB
+}
+
+func NewPostgresBudgetStore(db *sql.DB) *PostgresBudgetStore {
+	return &PostgresBudgetStore{
+		db: db,
+	}
+}
+
+type BudgetStore interface {
+	UpsertBudget(budget *Budget) (*Budget, error)
+	GetBudgetByID(id int64) (*Budget, error)
+	GetBudgets(user_id int64, month *string) ([]Budget, error)
+	UpdateBudget(budget *Budget) error
+	DeleteBudgetByID(id int64) error
+	GetBudgetReport(user_id int64, month string) (*BudgetReport, error)
+}
+
+// UpsertBudget sets the limit for a category and month, replacing any limit
+// that was already set for the same pair.
+func (pg *PostgresBudgetStore) UpsertBudget(budget *Budget) (*Budget, error) {
+	query := `
+	INSERT INTO budgets (user_id, category_id, month, amount)
+	VALUES ($1, $2, to_date($3, 'YYYY-MM'), $4)
+	ON CONFLICT (user_id, category_id, month) DO UPDATE
+	SET amount = EXCLUDED.amount, updated_at = CURRENT_TIMESTAMP
+	RETURNING id, created_at, updated_at
+	`
+	err := pg.db.QueryRow(query, budget.UserID, budget.CategoryID, budget.Month, budget.Amount).Scan(&budget.ID, &budget.CreatedAt, &budget.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return budget, nil
+}
+
+func (pg *PostgresBudgetStore) GetBudgetByID(id int64) (*Budget, error) {
+	budget := &Budget{}
+	query := `
+	SELECT b.id, b.user_id, b.category_id, category_path(c.id), to_char(b.month, 'YYYY-MM'), b.amount, b.created_at, b.updated_at
+	FROM budgets b
+	JOIN categories c ON c.id = b.category_id
+	WHERE b.id = $1
+	`
+	err := pg.db.QueryRow(query, id).Scan(&budget.ID, &budget.UserID, &budget.CategoryID, &budget.Category, &budget.Month, &budget.Amount, &budget.CreatedAt, &budget.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return budget, nil
+}
+
+func (pg *PostgresBudgetStore) GetBudgets(user_id int64, month *string) ([]Budget, error) {
+	query := `
+	SELECT b.id, b.user_id, b.category_id, category_path(c.id), to_char(b.month, 'YYYY-MM'), b.amount, b.created_at, b.updated_at
+	FROM budgets b
+	JOIN categories c ON c.id = b.category_id
+	WHERE b.user_id = $1
+	AND ($2::text IS NULL OR b.month = to_date($2, 'YYYY-MM'))
+	ORDER BY b.month DESC, 4
+	`
+	rows, err := pg.db.Query(query, user_id, month)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	budgets := []Budget{}
+	for rows.Next() {
+		budget := Budget{}
+		err := rows.Scan(&budget.ID, &budget.UserID, &budget.CategoryID, &budget.Category, &budget.Month, &budget.Amount, &budget.CreatedAt, &budget.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, budget)
+	}
+	return budgets, rows.Err()
+}
+
+func (pg *PostgresBudgetStore) UpdateBudget(budget *Budget) error {
+	query := `
+	UPDATE budgets
+	SET amount = $1, updated_at = $2
+	WHERE id = $3
+	`
+	result, err := pg.db.Exec(query, budget.Amount, budget.UpdatedAt, budget.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (pg *PostgresBudgetStore) DeleteBudgetByID(id int64) error {
+	query := `
+	DELETE FROM budgets
+	WHERE id = $1
+	`
+	result, err := pg.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetBudgetReport compares each limit of the month against the expenses in
+// its category and all of its subcategories, split expenses by their
+// splits. Budgets nested under another budget are listed but left out of
+// the totals, so no expense is counted twice. Categories with spending that
+// no limit covers are reported under Unbudgeted. Limits are in the user's
+// base currency and expenses in other currencies are converted; expenses
+// without a known rate are left out.
+func (pg *PostgresBudgetStore) GetBudgetReport(user_id int64, month string) (*BudgetReport, error) {
+	query := `
+	WITH spent AS (
+		SELECT COALESCE(s.category_id, e.category_id) AS category_id,
+		SUM(convert_amount(COALESCE(s.amount, e.amount), e.currency, u.base_currency, e.date)) AS spent
+		FROM expenses e
+		JOIN users u ON u.id = e.user_id
+		LEFT JOIN expense_splits s ON s.expense_id = e.id
+		WHERE e.user_id = $1
+		AND e.date >= to_date($2, 'YYYY-MM')
+		AND e.date < to_date($2, 'YYYY-MM') + INTERVAL '1 month'
+		GROUP BY 1
+	)
+	SELECT b.id, c.id, category_path(c.id), b.amount,
+	COALESCE((SELECT SUM(s.spent) FROM spent s WHERE s.category_id IN (SELECT id FROM category_subtree(b.category_id))), 0),
+	NOT EXISTS (
+		SELECT 1 FROM budgets p
+		WHERE p.user_id = $1 AND p.month = b.month AND p.id <> b.id
+		AND b.category_id IN (SELECT id FROM category_subtree(p.category_id))
+	)
+	FROM budgets b
+	JOIN categories c ON c.id = b.category_id
+	WHERE b.user_id = $1 AND b.month = to_date($2, 'YYYY-MM')
+
+	UNION ALL
+
+	SELECT NULL, c.id, category_path(c.id), NULL, COALESCE(s.spent, 0), FALSE
+	FROM spent s
+	JOIN categories c ON c.id = s.category_id
+	WHERE NOT EXISTS (
+		SELECT 1 FROM budgets b
+		WHERE b.user_id = $1 AND b.month = to_date($2, 'YYYY-MM')
+		AND s.category_id IN (SELECT id FROM category_subtree(b.category_id))
+	)
+
+	ORDER BY 3
+	`
+	rows, err := pg.db.Query(query, user_id, month)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &BudgetReport{Month: month, Budgets: []BudgetReportLine{}}
+	report.Unbudgeted.Categories = []BudgetReportLine{}
+	for rows.Next() {
+		line := BudgetReportLine{}
+		var outermost bool
+		err := rows.Scan(&line.BudgetID, &line.CategoryID, &line.Category, &line.Limit, &line.Spent, &outermost)
+		if err != nil {
+			return nil, err
+		}
+
+		if line.Limit == nil {
+			report.Unbudgeted.Spent += line.Spent
+			report.Unbudgeted.Categories = append(report.Unbudgeted.Categories, line)
+			continue
+		}
+
+		remaining := *line.Limit - line.Spent
+		line.Remaining = &remaining
+		if *line.Limit > 0 {
+			percentUsed := line.Spent.Float64() / line.Limit.Float64() * 100
+			line.PercentUsed = &percentUsed
+		}
+		if outermost {
+			report.TotalLimit += *line.Limit
+			report.TotalSpent += line.Spent
+		}
+		report.Budgets = append(report.Budgets, line)
+	}
+	return report, rows.Err()
+}
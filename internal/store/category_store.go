@@ -2,14 +2,47 @@ package store
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 )
 
+var (
+	ErrCategoryExists = errors.New("a category with this name already exists under the same parent")
+	ErrCategoryCycle  = errors.New("a category cannot be moved below itself")
+	ErrCategoryInUse  = errors.New("category still has transactions, budgets or subcategories")
+)
+
+// CategoryKindError means a category cannot be used for the type of
+// transaction at hand.
+type CategoryKindError struct {
+	Category *Category
+}
+
+func (e *CategoryKindError) Error() string {
+	return fmt.Sprintf("category %q is for %ss only", e.Category.Path, e.Category.Kind)
+}
+
 type Category struct {
-	ID        int64     `json:"id"`
-	UserID    int64     `json:"user_id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
+	ID       int64  `json:"id"`
+	UserID   int64  `json:"user_id"`
+	ParentID *int64 `json:"parent_id"`
+	Name     string `json:"name"`
+	// full name from the root, e.g. "food/groceries"
+	Path string `json:"path"`
+	Kind string `json:"kind"` // expense, income or both
+	// "#rrggbb" and an icon key picked by the client, both optional
+	Color     *string    `json:"color"`
+	Icon      *string    `json:"icon"`
+	Children  []Category `json:"children,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Allows reports whether the category may be used for an expense or an
+// income.
+func (c *Category) Allows(_type string) bool {
+	return c.Kind == "both" || c.Kind == _type
 }
 
 type PostgresCategoryStore struct {
@@ -25,61 +58,448 @@ func NewPostgresCategoryStore(db *sql.DB) *PostgresCategoryStore {
 type CategoryStore interface {
 	FindOrCreateCategoryByName(category *Category) (*Category, error)
 	GetCategoryIDByName(name *string, user_id int64) (*int64, error)
-	GetCategories(user_id int64) ([]Category, error)
+	GetCategories(user_id int64, kind string) ([]Category, error)
+
+	CreateCategory(category *Category) (*Category, error)
+	GetCategoryByID(id int64) (*Category, error)
+	GetCategoryTree(user_id int64, kind string) ([]Category, error)
+	MoveCategory(id int64, parentID *int64) error
+	UpdateCategory(category *Category) error
+	MergeCategory(id int64, targetID int64) error
+	DeleteCategoryByID(id int64) error
+	CategoryUsedFor(id int64, _type string) (bool, error)
 }
 
-func (p *PostgresCategoryStore) FindOrCreateCategoryByName(category *Category) (*Category, error) {
-	query := `
-    INSERT INTO categories (user_id, name)
-    VALUES ($1, $2)
-    ON CONFLICT (user_id, name) DO NOTHING
-    RETURNING id, created_at
-    `
-	err := p.db.QueryRow(query, category.UserID, category.Name).Scan(&category.ID, &category.CreatedAt)
-	if err == sql.ErrNoRows {
-		// category already exists, fetch it
-		query := `SELECT id, created_at FROM categories WHERE user_id = $1 AND name = $2`
-		err = p.db.QueryRow(query, category.UserID, category.Name).Scan(&category.ID, &category.CreatedAt)
-		if err != nil {
-			return nil, err
+// SplitCategoryPath splits "food/groceries" into its names. Empty segments
+// are dropped, and a path without any name means "uncategorized".
+func SplitCategoryPath(path string) []string {
+	names := []string{}
+	for _, name := range strings.Split(path, "/") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
 		}
-		return category, nil
-	} else if err != nil {
+	}
+	if len(names) == 0 {
+		names = append(names, "uncategorized")
+	}
+	return names
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// findCategory looks up one level of a path.
+func findCategory(q queryRower, user_id int64, parentID *int64, name string) (*Category, error) {
+	category := &Category{UserID: user_id, ParentID: parentID, Name: name}
+	query := `
+	SELECT id, kind, color, icon, created_at FROM categories
+	WHERE user_id = $1 AND parent_id IS NOT DISTINCT FROM $2 AND name = $3
+	`
+	err := q.QueryRow(query, user_id, parentID, name).Scan(&category.ID, &category.Kind, &category.Color, &category.Icon, &category.CreatedAt)
+	if err != nil {
 		return nil, err
 	}
 	return category, nil
 }
 
-func (p *PostgresCategoryStore) GetCategoryIDByName(name *string, user_id int64) (*int64, error) {
-	query := `SELECT id 
-	FROM categories
-	WHERE name = $1 AND user_id = $2
-	`
-	var id int64
-	err := p.db.QueryRow(query, name, user_id).Scan(&id)
+// FindOrCreateCategoryByName accepts a plain name or a "parent/child" path
+// and creates every missing level with the kind of category, "both" when it
+// is empty. The returned category is the last one; existing levels keep
+// their kind, so callers should check Allows.
+func (p *PostgresCategoryStore) FindOrCreateCategoryByName(category *Category) (*Category, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := findOrCreateCategory(tx, category)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
 	if err != nil {
 		return nil, err
 	}
-	return &id, nil
+	return current, nil
 }
 
-func (p *PostgresCategoryStore) GetCategories(user_id int64) ([]Category, error) {
-	query := `SELECT id, user_id, name, created_at
-	FROM categories
-	WHERE user_id = $1`
-	rows, err := p.db.Query(query, user_id)
+// findOrCreateCategory is FindOrCreateCategoryByName within tx.
+func findOrCreateCategory(tx *sql.Tx, category *Category) (*Category, error) {
+	kind := category.Kind
+	if kind == "" {
+		kind = "both"
+	}
+
+	names := SplitCategoryPath(category.Name)
+	var parentID *int64
+	var current *Category
+	for _, name := range names {
+		current = &Category{UserID: category.UserID, ParentID: parentID, Name: name, Kind: kind}
+		query := `
+		INSERT INTO categories (user_id, parent_id, name, kind)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, (COALESCE(parent_id, 0)), name) DO NOTHING
+		RETURNING id, created_at
+		`
+		err := tx.QueryRow(query, current.UserID, current.ParentID, current.Name, current.Kind).Scan(&current.ID, &current.CreatedAt)
+		if err == sql.ErrNoRows {
+			// category already exists, fetch it
+			current, err = findCategory(tx, category.UserID, parentID, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		parentID = &current.ID
+	}
+
+	current.Path = strings.Join(names, "/")
+	return current, nil
+}
+
+// GetCategoryIDByName resolves a plain name or a "parent/child" path.
+func (p *PostgresCategoryStore) GetCategoryIDByName(name *string, user_id int64) (*int64, error) {
+	var parentID *int64
+	for _, segment := range SplitCategoryPath(*name) {
+		category, err := findCategory(p.db, user_id, parentID, segment)
+		if err != nil {
+			return nil, err
+		}
+		parentID = &category.ID
+	}
+	return parentID, nil
+}
+
+// GetCategories returns the categories of the user as a flat list sorted by
+// path, so children follow their parent. A kind of expense or income also
+// keeps the categories of kind both; an empty kind keeps everything.
+func (p *PostgresCategoryStore) GetCategories(user_id int64, kind string) ([]Category, error) {
+	query := `
+	WITH RECURSIVE tree AS (
+		SELECT id, user_id, parent_id, name, name::text AS path, kind, color, icon, created_at
+		FROM categories
+		WHERE user_id = $1 AND parent_id IS NULL
+
+		UNION ALL
+
+		SELECT c.id, c.user_id, c.parent_id, c.name, t.path || '/' || c.name, c.kind, c.color, c.icon, c.created_at
+		FROM categories c
+		JOIN tree t ON c.parent_id = t.id
+	)
+	SELECT id, user_id, parent_id, name, path, kind, color, icon, created_at
+	FROM tree
+	WHERE $2 = '' OR kind IN ($2, 'both')
+	ORDER BY path
+	`
+	rows, err := p.db.Query(query, user_id, kind)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var categories []Category
+	categories := []Category{}
 	for rows.Next() {
 		var category Category
-		err := rows.Scan(&category.ID, &category.UserID, &category.Name, &category.CreatedAt)
+		err := rows.Scan(&category.ID, &category.UserID, &category.ParentID, &category.Name, &category.Path,
+			&category.Kind, &category.Color, &category.Icon, &category.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
 		categories = append(categories, category)
 	}
-	return categories, nil
+	return categories, rows.Err()
+}
+
+// GetCategoryTree returns the top-level categories with their descendants
+// nested in Children. When kind filters out a parent, its children of the
+// kind are listed at the top instead.
+func (p *PostgresCategoryStore) GetCategoryTree(user_id int64, kind string) ([]Category, error) {
+	categories, err := p.GetCategories(user_id, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := map[int64]bool{}
+	for _, category := range categories {
+		listed[category.ID] = true
+	}
+	children := map[int64][]Category{}
+	for _, category := range categories {
+		if category.ParentID != nil && listed[*category.ParentID] {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+	var attach func(category Category) Category
+	attach = func(category Category) Category {
+		for _, child := range children[category.ID] {
+			category.Children = append(category.Children, attach(child))
+		}
+		return category
+	}
+
+	tree := []Category{}
+	for _, category := range categories {
+		if category.ParentID == nil || !listed[*category.ParentID] {
+			tree = append(tree, attach(category))
+		}
+	}
+	return tree, nil
+}
+
+// CreateCategory creates a single category below ParentID, or at the top
+// when it is nil. It returns ErrCategoryExists instead of reusing a match.
+func (p *PostgresCategoryStore) CreateCategory(category *Category) (*Category, error) {
+	query := `
+	INSERT INTO categories (user_id, parent_id, name, kind, color, icon)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (user_id, (COALESCE(parent_id, 0)), name) DO NOTHING
+	RETURNING id, created_at
+	`
+	err := p.db.QueryRow(query, category.UserID, category.ParentID, category.Name, category.Kind, category.Color, category.Icon).Scan(&category.ID, &category.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrCategoryExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.db.QueryRow(`SELECT category_path($1)`, category.ID).Scan(&category.Path)
+	if err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+func (p *PostgresCategoryStore) GetCategoryByID(id int64) (*Category, error) {
+	category := &Category{}
+	query := `
+	SELECT id, user_id, parent_id, name, category_path(id), kind, color, icon, created_at
+	FROM categories
+	WHERE id = $1
+	`
+	err := p.db.QueryRow(query, id).Scan(&category.ID, &category.UserID, &category.ParentID, &category.Name, &category.Path,
+		&category.Kind, &category.Color, &category.Icon, &category.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// MoveCategory re-parents a category together with its subtree. A nil
+// parentID moves it to the top level.
+func (p *PostgresCategoryStore) MoveCategory(id int64, parentID *int64) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var name string
+	var user_id int64
+	err = tx.QueryRow(`SELECT user_id, name FROM categories WHERE id = $1 FOR UPDATE`, id).Scan(&user_id, &name)
+	if err != nil {
+		return err
+	}
+
+	if parentID != nil {
+		var cycle bool
+		err = tx.QueryRow(`SELECT $2::bigint IN (SELECT id FROM category_subtree($1))`, id, *parentID).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return ErrCategoryCycle
+		}
+	}
+
+	_, err = findCategory(tx, user_id, parentID, name)
+	if err == nil {
+		return ErrCategoryExists
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE categories SET parent_id = $1 WHERE id = $2`, parentID, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateCategory saves the name, kind, color and icon of a category in
+// place, keeping its parent and everything that points at it.
+func (p *PostgresCategoryStore) UpdateCategory(category *Category) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var parentID *int64
+	err = tx.QueryRow(`SELECT parent_id FROM categories WHERE id = $1 FOR UPDATE`, category.ID).Scan(&parentID)
+	if err != nil {
+		return err
+	}
+
+	existing, err := findCategory(tx, category.UserID, parentID, category.Name)
+	if err == nil && existing.ID != category.ID {
+		return ErrCategoryExists
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	query := `
+	UPDATE categories
+	SET name = $1, kind = $2, color = $3, icon = $4
+	WHERE id = $5
+	`
+	_, err = tx.Exec(query, category.Name, category.Kind, category.Color, category.Icon, category.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MergeCategory moves the expenses, splits, incomes, recurring rules, budgets
+// and subcategories of a category into targetID and deletes it, all in one
+// transaction. Budgets of the same month are added together.
+func (p *PostgresCategoryStore) MergeCategory(id int64, targetID int64) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var locked int
+	query := `
+	SELECT COUNT(*) FROM (
+		SELECT id FROM categories WHERE id IN ($1, $2) ORDER BY id FOR UPDATE
+	) c
+	`
+	err = tx.QueryRow(query, id, targetID).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if locked != 2 {
+		return sql.ErrNoRows
+	}
+
+	// the target cannot be the category itself or one of its subcategories
+	var cycle bool
+	err = tx.QueryRow(`SELECT $2::bigint IN (SELECT id FROM category_subtree($1))`, id, targetID).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrCategoryCycle
+	}
+
+	var conflict bool
+	query = `
+	SELECT EXISTS (
+		SELECT 1 FROM categories s
+		JOIN categories t ON t.parent_id = $2 AND t.name = s.name
+		WHERE s.parent_id = $1
+	)
+	`
+	err = tx.QueryRow(query, id, targetID).Scan(&conflict)
+	if err != nil {
+		return err
+	}
+	if conflict {
+		return ErrCategoryExists
+	}
+
+	statements := []string{
+		`UPDATE expenses SET category_id = $2 WHERE category_id = $1`,
+		`UPDATE incomes SET category_id = $2 WHERE category_id = $1`,
+		`UPDATE expense_splits SET category_id = $2 WHERE category_id = $1`,
+		`UPDATE recurring_rules SET category_id = $2 WHERE category_id = $1`,
+		`
+		INSERT INTO budgets (user_id, category_id, month, amount)
+		SELECT user_id, $2, month, amount FROM budgets WHERE category_id = $1
+		ON CONFLICT (user_id, category_id, month) DO UPDATE
+		SET amount = budgets.amount + EXCLUDED.amount, updated_at = CURRENT_TIMESTAMP
+		`,
+		`UPDATE categories SET parent_id = $2 WHERE parent_id = $1`,
+	}
+	for _, statement := range statements {
+		_, err = tx.Exec(statement, id, targetID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the source budgets go with the category
+	_, err = tx.Exec(`DELETE FROM categories WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CategoryUsedFor reports whether any expense or income of _type, split,
+// budget, recurring rule or rule that sets the category is booked on it.
+// Splits and budgets count as expenses.
+func (p *PostgresCategoryStore) CategoryUsedFor(id int64, _type string) (bool, error) {
+	var used bool
+	query := `
+	SELECT CASE $2::text
+		WHEN 'expense' THEN EXISTS (SELECT 1 FROM expenses WHERE category_id = $1)
+			OR EXISTS (SELECT 1 FROM expense_splits WHERE category_id = $1)
+			OR EXISTS (SELECT 1 FROM budgets WHERE category_id = $1)
+		ELSE EXISTS (SELECT 1 FROM incomes WHERE category_id = $1)
+	END
+	OR EXISTS (SELECT 1 FROM recurring_rules WHERE category_id = $1 AND type = $2)
+	OR EXISTS (
+		SELECT 1 FROM rules r JOIN categories c ON c.id = $1 AND r.user_id = c.user_id
+		WHERE r.actions->>'set_category' = category_path($1) AND r.conditions->>'type' = $2
+	)
+	`
+	err := p.db.QueryRow(query, id, _type).Scan(&used)
+	return used, err
+}
+
+// DeleteCategoryByID refuses to delete a category that anything still points
+// at and returns ErrCategoryInUse instead; MergeCategory reassigns them.
+func (p *PostgresCategoryStore) DeleteCategoryByID(id int64) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inUse bool
+	query := `
+	SELECT EXISTS (SELECT 1 FROM expenses WHERE category_id = $1)
+	OR EXISTS (SELECT 1 FROM incomes WHERE category_id = $1)
+	OR EXISTS (SELECT 1 FROM expense_splits WHERE category_id = $1)
+	OR EXISTS (SELECT 1 FROM recurring_rules WHERE category_id = $1)
+	OR EXISTS (SELECT 1 FROM budgets WHERE category_id = $1)
+	OR EXISTS (SELECT 1 FROM categories WHERE parent_id = $1)
+	`
+	err = tx.QueryRow(query, id).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrCategoryInUse
+	}
+
+	result, err := tx.Exec(`DELETE FROM categories WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
 }
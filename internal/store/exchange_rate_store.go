@@ -0,0 +1,123 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultCurrency = "INR"
+
+var ErrInvalidCurrency = errors.New("currency must be a 3-letter ISO 4217 code")
+
+// NormalizeCurrency upper-cases a currency code and checks that it looks
+// like an ISO 4217 code.
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return "", ErrInvalidCurrency
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return "", ErrInvalidCurrency
+		}
+	}
+	return code, nil
+}
+
+type ExchangeRate struct {
+	FromCurrency  string    `json:"from_currency"`
+	ToCurrency    string    `json:"to_currency"`
+	EffectiveDate time.Time `json:"effective_date"`
+	Rate          string    `json:"rate"` // decimal string, 1 FromCurrency = Rate ToCurrency
+}
+
+// ReadExchangeRatesCSV parses rows of date,from,to,rate such as
+// "2024-01-31,USD,INR,83.05". A header row is skipped if present.
+func ReadExchangeRatesCSV(r io.Reader) ([]ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 4
+	reader.TrimLeadingSpace = true
+
+	rates := []ExchangeRate{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		date, err := time.Parse("2006-01-02", record[0])
+		if err != nil {
+			if line == 1 {
+				continue // header
+			}
+			return nil, fmt.Errorf("line %d: invalid date %q", line, record[0])
+		}
+		from, err := NormalizeCurrency(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		to, err := NormalizeCurrency(record[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rate, err := strconv.ParseFloat(record[3], 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("line %d: invalid rate %q", line, record[3])
+		}
+
+		rates = append(rates, ExchangeRate{
+			FromCurrency:  from,
+			ToCurrency:    to,
+			EffectiveDate: date,
+			Rate:          strings.TrimSpace(record[3]),
+		})
+	}
+	return rates, nil
+}
+
+type PostgresExchangeRateStore struct {
+	db *sql.DB
+}
+
+func NewPostgresExchangeRateStore(db *sql.DB) *PostgresExchangeRateStore {
+	return &PostgresExchangeRateStore{
+		db: db,
+	}
+}
+
+type ExchangeRateStore interface {
+	UpsertExchangeRates(rates []ExchangeRate) error
+}
+
+// UpsertExchangeRates stores all rates in one transaction, replacing rates
+// already loaded for the same pair and date.
+func (pg *PostgresExchangeRateStore) UpsertExchangeRates(rates []ExchangeRate) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO exchange_rates (from_currency, to_currency, effective_date, rate)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (from_currency, to_currency, effective_date) DO UPDATE
+	SET rate = EXCLUDED.rate
+	`
+	for _, rate := range rates {
+		_, err := tx.Exec(query, rate.FromCurrency, rate.ToCurrency, rate.EffectiveDate, rate.Rate)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
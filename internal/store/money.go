@@ -0,0 +1,154 @@
+package store
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount in minor units (hundredths of the currency unit).
+// Amounts are stored as NUMERIC(14,2) and travel as decimal strings between
+// Go and Postgres, so sums are exact instead of drifting like float64 does.
+type Money int64
+
+const moneyScale = 100
+
+var ErrInvalidMoney = errors.New("invalid amount")
+
+// ParseMoney parses a decimal string such as "12", "-0.5", ".75" or "1234.56".
+// More than two fractional digits are rejected rather than rounded.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	whole, frac, hasPoint := strings.Cut(s, ".")
+	if whole == "" && frac != "" {
+		whole = "0"
+	}
+	if whole == "" || len(frac) > 2 || (hasPoint && frac == "") {
+		return 0, ErrInvalidMoney
+	}
+	for _, part := range []string{whole, frac} {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return 0, ErrInvalidMoney
+			}
+		}
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > (1<<62)/moneyScale {
+		return 0, ErrInvalidMoney
+	}
+	var cents int64
+	if frac != "" {
+		cents, _ = strconv.ParseInt(frac, 10, 64)
+		if len(frac) == 1 {
+			cents *= 10
+		}
+	}
+
+	m := Money(units*moneyScale + cents)
+	if negative {
+		m = -m
+	}
+	return m, nil
+}
+
+// String formats the amount with exactly two decimals, e.g. "-12.30".
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/moneyScale, v%moneyScale)
+}
+
+// Float64 is only meant for ratios such as percentages, never for sums.
+func (m Money) Float64() float64 {
+	return float64(m) / moneyScale
+}
+
+// MarshalJSON encodes the amount as a fixed-scale JSON number such as 12.30.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts both JSON numbers and decimal strings. null leaves
+// the amount as it is, like for the other types encoding/json decodes.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	data = bytes.Trim(data, `"`)
+	parsed, err := ParseMoney(string(data))
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, data)
+	}
+	*m = parsed
+	return nil
+}
+
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		return m.scanDecimal(v)
+	case []byte:
+		return m.scanDecimal(string(v))
+	case int64:
+		*m = Money(v * moneyScale)
+		return nil
+	case float64:
+		// float8 expressions; rounded to the nearest minor unit
+		*m = Money(math.Round(v * moneyScale))
+		return nil
+	case nil:
+		*m = 0
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+}
+
+// scanDecimal accepts the NUMERIC text Postgres returns, which can carry
+// more than two decimals for computed columns (e.g. SUM over NUMERIC without
+// a scale). Extra digits are rounded half away from zero.
+func (m *Money) scanDecimal(s string) error {
+	whole, frac, _ := strings.Cut(s, ".")
+	if len(frac) <= 2 {
+		parsed, err := ParseMoney(s)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+
+	parsed, err := ParseMoney(whole + "." + frac[:2])
+	if err != nil {
+		return err
+	}
+	if frac[2] >= '5' {
+		if parsed < 0 || strings.HasPrefix(whole, "-") {
+			parsed--
+		} else {
+			parsed++
+		}
+	}
+	*m = parsed
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
@@ -0,0 +1,187 @@
+package store
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: "12", want: 1200},
+		{in: "12.3", want: 1230},
+		{in: "12.34", want: 1234},
+		{in: "-0.5", want: -50},
+		{in: "+7.01", want: 701},
+		{in: ".75", want: 75},
+		{in: " 1234.56 ", want: 123456},
+		{in: "0", want: 0},
+		{in: "12.345", wantErr: true},
+		{in: "0.001", wantErr: true},
+		{in: "12.", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "-", wantErr: true},
+		{in: "1e3", wantErr: true},
+		{in: "1,000", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "99999999999999999999", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseMoney(%q) = %v, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMoney(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{in: 0, want: "0.00"},
+		{in: 5, want: "0.05"},
+		{in: 1230, want: "12.30"},
+		{in: -1230, want: "-12.30"},
+		{in: -5, want: "-0.05"},
+		{in: 123456789, want: "1234567.89"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", tt.in, got, tt.want)
+		}
+		got, err := json.Marshal(tt.in)
+		if err != nil {
+			t.Errorf("json.Marshal(Money(%d)) error: %v", tt.in, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("json.Marshal(Money(%d)) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: `{"amount": 12.3}`, want: 1230},
+		{in: `{"amount": "12.30"}`, want: 1230},
+		{in: `{"amount": -0.05}`, want: -5},
+		{in: `{"amount": null}`, want: 4200}, // not given, keeps the old value
+		{in: `{}`, want: 4200},
+		{in: `{"amount": 0.123}`, wantErr: true},
+		{in: `{"amount": "abc"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		v := struct {
+			Amount Money `json:"amount"`
+		}{Amount: 4200}
+		err := json.Unmarshal([]byte(tt.in), &v)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("json.Unmarshal(%s) = %v, want error", tt.in, v.Amount)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("json.Unmarshal(%s) error: %v", tt.in, err)
+			continue
+		}
+		if v.Amount != tt.want {
+			t.Errorf("json.Unmarshal(%s) = %d, want %d", tt.in, v.Amount, tt.want)
+		}
+	}
+
+	var amount *Money
+	err := json.Unmarshal([]byte(`null`), &amount)
+	if err != nil || amount != nil {
+		t.Errorf("json.Unmarshal(null) into *Money = %v, %v, want nil, nil", amount, err)
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		src  any
+		want Money
+	}{
+		// scanDecimal rounds extra digits half away from zero
+		{src: "12.34", want: 1234},
+		{src: "12.3", want: 1230},
+		{src: "12", want: 1200},
+		{src: "12.344", want: 1234},
+		{src: "12.345", want: 1235},
+		{src: "12.3449", want: 1234},
+		{src: "-12.344", want: -1234},
+		{src: "-12.345", want: -1235},
+		{src: "-0.005", want: -1},
+		{src: "0.005", want: 1},
+		{src: "0.00499999", want: 0},
+		{src: []byte("1.999"), want: 200},
+		{src: int64(3), want: 300},
+		{src: float64(0.1) + float64(0.2), want: 30},
+		{src: float64(-12.345), want: -1235},
+		{src: nil, want: 0},
+	}
+
+	for _, tt := range tests {
+		var got Money = 99
+		err := got.Scan(tt.src)
+		if err != nil {
+			t.Errorf("Scan(%#v) error: %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Scan(%#v) = %d, want %d", tt.src, got, tt.want)
+		}
+	}
+
+	var m Money
+	if err := m.Scan(true); err == nil {
+		t.Errorf("Scan(true) = %v, want error", m)
+	}
+}
+
+func TestMoneySumIsExact(t *testing.T) {
+	tests := []struct {
+		amounts []string
+		want    string
+	}{
+		{amounts: []string{"0.10", "0.20"}, want: "0.30"},
+		{amounts: []string{"0.1", "0.2", "-0.3"}, want: "0.00"},
+		{amounts: []string{"0.01", "0.01", "0.01", "0.01", "0.01", "0.01", "0.01", "0.01", "0.01", "0.01"}, want: "0.10"},
+		{amounts: []string{"1000000.10", "0.20"}, want: "1000000.30"},
+	}
+
+	for _, tt := range tests {
+		var sum Money
+		for _, amount := range tt.amounts {
+			m, err := ParseMoney(amount)
+			if err != nil {
+				t.Fatalf("ParseMoney(%q) error: %v", amount, err)
+			}
+			sum += m
+		}
+		if sum.String() != tt.want {
+			t.Errorf("sum of %v = %s, want %s", tt.amounts, sum, tt.want)
+		}
+	}
+}
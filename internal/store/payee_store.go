@@ -0,0 +1,179 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Payee is who an expense was paid to, or who paid an income.
+type Payee struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PayeeSummary totals the expenses paid to and the incomes received from a
+// payee, in the user's base currency. Transactions without a known rate are
+// left out of the totals and counted in MissingRates.
+type PayeeSummary struct {
+	Payee        *Payee     `json:"payee"`
+	From         *string    `json:"from,omitempty"`
+	To           *string    `json:"to,omitempty"`
+	Currency     string     `json:"currency"`
+	Expense      Money      `json:"expense"`
+	ExpenseCount int        `json:"expense_count"`
+	Income       Money      `json:"income"`
+	IncomeCount  int        `json:"income_count"`
+	FirstSeen    *time.Time `json:"first_seen"`
+	LastSeen     *time.Time `json:"last_seen"`
+	MissingRates int        `json:"missing_rates"`
+}
+
+// payeeColumn selects the payee name of a row of expenses or incomes.
+func payeeColumn(row string) string {
+	return `(SELECT p.name FROM payees p WHERE p.id = ` + row + `.payee_id)`
+}
+
+type PostgresPayeeStore struct {
+	db *sql.DB
+}
+
+func NewPostgresPayeeStore(db *sql.DB) *PostgresPayeeStore {
+	return &PostgresPayeeStore{
+		db: db,
+	}
+}
+
+type PayeeStore interface {
+	FindOrCreatePayeeByName(payee *Payee) (*Payee, error)
+	GetPayeeByID(id int64) (*Payee, error)
+	GetPayees(user_id int64) ([]Payee, error)
+	GetPayeeSummary(id int64, from *time.Time, to *time.Time) (*PayeeSummary, error)
+}
+
+// FindOrCreatePayeeByName returns the user's payee with the name, ignoring
+// case, and creates it with the name as given when there is none.
+func (pg *PostgresPayeeStore) FindOrCreatePayeeByName(payee *Payee) (*Payee, error) {
+	return findOrCreatePayee(pg.db, payee)
+}
+
+// findOrCreatePayee is FindOrCreatePayeeByName on q, which may be a
+// transaction.
+func findOrCreatePayee(q queryRower, payee *Payee) (*Payee, error) {
+	payee.Name = strings.TrimSpace(payee.Name)
+	query := `
+	INSERT INTO payees (user_id, name)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id, lower(name)) DO NOTHING
+	RETURNING id, created_at
+	`
+	err := q.QueryRow(query, payee.UserID, payee.Name).Scan(&payee.ID, &payee.CreatedAt)
+	if err == sql.ErrNoRows {
+		// payee already exists, fetch it
+		query = `
+		SELECT id, name, created_at FROM payees
+		WHERE user_id = $1 AND lower(name) = lower($2)
+		`
+		err = q.QueryRow(query, payee.UserID, payee.Name).Scan(&payee.ID, &payee.Name, &payee.CreatedAt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return payee, nil
+}
+
+func (pg *PostgresPayeeStore) GetPayeeByID(id int64) (*Payee, error) {
+	payee := &Payee{}
+	query := `
+	SELECT id, user_id, name, created_at
+	FROM payees
+	WHERE id = $1
+	`
+	err := pg.db.QueryRow(query, id).Scan(&payee.ID, &payee.UserID, &payee.Name, &payee.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return payee, nil
+}
+
+func (pg *PostgresPayeeStore) GetPayees(user_id int64) ([]Payee, error) {
+	query := `
+	SELECT id, user_id, name, created_at
+	FROM payees
+	WHERE user_id = $1
+	ORDER BY lower(name)
+	`
+	rows, err := pg.db.Query(query, user_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payees := []Payee{}
+	for rows.Next() {
+		var payee Payee
+		err := rows.Scan(&payee.ID, &payee.UserID, &payee.Name, &payee.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		payees = append(payees, payee)
+	}
+	return payees, rows.Err()
+}
+
+// GetPayeeSummary totals the payee's transactions, optionally only those
+// between from and to, both inclusive.
+func (pg *PostgresPayeeStore) GetPayeeSummary(id int64, from *time.Time, to *time.Time) (*PayeeSummary, error) {
+	payee, err := pg.GetPayeeByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	WITH amounts AS (
+		SELECT 'expense' AS type, e.date, convert_amount(e.amount, e.currency, u.base_currency, e.date) AS amount
+		FROM expenses e
+		JOIN users u ON u.id = e.user_id
+		WHERE e.payee_id = $1
+
+		UNION ALL
+
+		SELECT 'income', i.date, convert_amount(i.amount, i.currency, u.base_currency, i.date)
+		FROM incomes i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.payee_id = $1
+	)
+	SELECT
+	COALESCE(SUM(amount) FILTER (WHERE type = 'expense'), 0),
+	COUNT(*) FILTER (WHERE type = 'expense'),
+	COALESCE(SUM(amount) FILTER (WHERE type = 'income'), 0),
+	COUNT(*) FILTER (WHERE type = 'income'),
+	MIN(date), MAX(date),
+	COUNT(*) FILTER (WHERE amount IS NULL)
+	FROM amounts
+	WHERE ($2::timestamptz IS NULL OR date >= $2)
+	AND ($3::timestamptz IS NULL OR date < $3::timestamptz + INTERVAL '1 day')
+	`
+	summary := &PayeeSummary{Payee: payee}
+	err = pg.db.QueryRow(query, id, from, to).Scan(&summary.Expense, &summary.ExpenseCount, &summary.Income, &summary.IncomeCount,
+		&summary.FirstSeen, &summary.LastSeen, &summary.MissingRates)
+	if err != nil {
+		return nil, err
+	}
+	if from != nil {
+		s := from.Format("2006-01-02")
+		summary.From = &s
+	}
+	if to != nil {
+		s := to.Format("2006-01-02")
+		summary.To = &s
+	}
+
+	err = pg.db.QueryRow(`SELECT base_currency FROM users WHERE id = $1`, payee.UserID).Scan(&summary.Currency)
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
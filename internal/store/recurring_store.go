@@ -0,0 +1,314 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+type RecurringRule struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Type        string     `json:"type"` // income or expense
+	Amount      Money      `json:"amount"`
+	Currency    string     `json:"currency"`
+	AccountID   *int64     `json:"account_id,omitempty"`
+	CategoryID  int64      `json:"category_id"`
+	Category    *string    `json:"category,omitempty"`
+	Source      string     `json:"source"` // for incomes
+	Note        string     `json:"note"`
+	Frequency   string     `json:"frequency"` // daily, weekly, monthly or yearly
+	Interval    int        `json:"interval"`
+	StartDate   *time.Time `json:"start_date"`
+	EndDate     *time.Time `json:"end_date"`
+	Count       *int       `json:"count"`
+	Occurrences int        `json:"occurrences"`
+	NextRun     *time.Time `json:"next_run"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// OccurrenceAt returns the date of the n-th occurrence (starting at 0) of the rule.
+// Every occurrence is computed from the start date so that monthly rules on the
+// 31st land on the last day of shorter months without drifting afterwards.
+func (r *RecurringRule) OccurrenceAt(n int) time.Time {
+	start := *r.StartDate
+	switch r.Frequency {
+	case "daily":
+		return start.AddDate(0, 0, n*r.Interval)
+	case "weekly":
+		return start.AddDate(0, 0, 7*n*r.Interval)
+	case "yearly":
+		return addMonthsClamped(start, 12*n*r.Interval)
+	default:
+		return addMonthsClamped(start, n*r.Interval)
+	}
+}
+
+// NextOccurrence returns the first occurrence that has not been materialized
+// yet, or nil when the rule has reached its end date or count.
+func (r *RecurringRule) NextOccurrence() *time.Time {
+	if r.Count != nil && r.Occurrences >= *r.Count {
+		return nil
+	}
+	next := r.OccurrenceAt(r.Occurrences)
+	if r.EndDate != nil && next.After(*r.EndDate) {
+		return nil
+	}
+	return &next
+}
+
+func addMonthsClamped(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	hour, min, sec := t.Clock()
+	firstOfMonth := time.Date(year, month+time.Month(months), 1, hour, min, sec, t.Nanosecond(), t.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return firstOfMonth.AddDate(0, 0, day-1)
+}
+
+type PostgresRecurringStore struct {
+	db *sql.DB
+}
+
+func NewPostgresRecurringStore(db *sql.DB) *PostgresRecurringStore {
+	return &PostgresRecurringStore{
+		db: db,
+	}
+}
+
+type RecurringStore interface {
+	CreateRecurringRule(rule *RecurringRule) (*RecurringRule, error)
+	GetRecurringRuleByID(id int64) (*RecurringRule, error)
+	GetRecurringRules(user_id int64) ([]RecurringRule, error)
+	UpdateRecurringRule(rule *RecurringRule) error
+	DeleteRecurringRuleByID(id int64) error
+
+	GetDueRecurringRuleIDs(now time.Time) ([]int64, error)
+	MaterializeRecurringRule(id int64, now time.Time) (int, error)
+}
+
+const recurringRuleColumns = `id, user_id, type, amount, currency, account_id, category_id, COALESCE(source, ''), COALESCE(note, ''), frequency, repeat_interval,
+	start_date, end_date, max_occurrences, occurrences, next_run, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRecurringRule(row rowScanner, rule *RecurringRule) error {
+	return row.Scan(&rule.ID, &rule.UserID, &rule.Type, &rule.Amount, &rule.Currency, &rule.AccountID, &rule.CategoryID, &rule.Source, &rule.Note, &rule.Frequency, &rule.Interval,
+		&rule.StartDate, &rule.EndDate, &rule.Count, &rule.Occurrences, &rule.NextRun, &rule.CreatedAt, &rule.UpdatedAt)
+}
+
+func (pg *PostgresRecurringStore) CreateRecurringRule(rule *RecurringRule) (*RecurringRule, error) {
+	rule.NextRun = rule.NextOccurrence()
+
+	query := `
+	INSERT INTO recurring_rules (user_id, type, amount, currency, account_id, category_id, source, note, frequency, repeat_interval, start_date, end_date, max_occurrences, occurrences, next_run)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+	RETURNING id, created_at, updated_at
+	`
+	err := pg.db.QueryRow(query, rule.UserID, rule.Type, rule.Amount, rule.Currency, rule.AccountID, rule.CategoryID, rule.Source, rule.Note, rule.Frequency, rule.Interval,
+		rule.StartDate, rule.EndDate, rule.Count, rule.Occurrences, rule.NextRun).Scan(&rule.ID, &rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (pg *PostgresRecurringStore) GetRecurringRuleByID(id int64) (*RecurringRule, error) {
+	rule := &RecurringRule{}
+
+	query := `SELECT ` + recurringRuleColumns + `
+	FROM recurring_rules
+	WHERE id = $1
+	`
+	err := scanRecurringRule(pg.db.QueryRow(query, id), rule)
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (pg *PostgresRecurringStore) GetRecurringRules(user_id int64) ([]RecurringRule, error) {
+	query := `SELECT ` + recurringRuleColumns + `
+	FROM recurring_rules
+	WHERE user_id = $1
+	ORDER BY next_run ASC NULLS LAST, id
+	`
+	rows, err := pg.db.Query(query, user_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []RecurringRule{}
+	for rows.Next() {
+		rule := RecurringRule{}
+		err := scanRecurringRule(rows, &rule)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// UpdateRecurringRule saves the rule and moves its schedule past the last
+// occurrence that was already materialized, so editing the schedule never
+// posts the same period twice.
+func (pg *PostgresRecurringStore) UpdateRecurringRule(rule *RecurringRule) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	table := "expenses"
+	if rule.Type == "income" {
+		table = "incomes"
+	}
+	var lastPosted *time.Time
+	err = tx.QueryRow(`SELECT MAX(date) FROM `+table+` WHERE recurring_rule_id = $1`, rule.ID).Scan(&lastPosted)
+	if err != nil {
+		return err
+	}
+
+	rule.Occurrences = 0
+	if lastPosted != nil {
+		for next := rule.NextOccurrence(); next != nil && !next.After(*lastPosted); next = rule.NextOccurrence() {
+			rule.Occurrences++
+		}
+	}
+	rule.NextRun = rule.NextOccurrence()
+
+	query := `
+	UPDATE recurring_rules
+	SET amount = $1, currency = $2, account_id = $3, category_id = $4, source = $5, note = $6, frequency = $7, repeat_interval = $8, start_date = $9,
+	end_date = $10, max_occurrences = $11, occurrences = $12, next_run = $13, updated_at = $14
+	WHERE id = $15
+	`
+	result, err := tx.Exec(query, rule.Amount, rule.Currency, rule.AccountID, rule.CategoryID, rule.Source, rule.Note, rule.Frequency, rule.Interval, rule.StartDate,
+		rule.EndDate, rule.Count, rule.Occurrences, rule.NextRun, rule.UpdatedAt, rule.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+func (pg *PostgresRecurringStore) DeleteRecurringRuleByID(id int64) error {
+	query := `
+	DELETE FROM recurring_rules
+	WHERE id = $1
+	`
+	result, err := pg.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (pg *PostgresRecurringStore) GetDueRecurringRuleIDs(now time.Time) ([]int64, error) {
+	query := `
+	SELECT id FROM recurring_rules
+	WHERE next_run IS NOT NULL AND next_run <= $1
+	ORDER BY next_run
+	`
+	rows, err := pg.db.Query(query, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// MaterializeRecurringRule posts every occurrence of the rule that is due at
+// now and returns how many rows were created. The rule row is locked for the
+// duration of the transaction and occurrences are inserted with ON CONFLICT
+// DO NOTHING, so concurrent or repeated runs never double-post.
+func (pg *PostgresRecurringStore) MaterializeRecurringRule(id int64, now time.Time) (int, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rule := &RecurringRule{}
+	query := `SELECT ` + recurringRuleColumns + `
+	FROM recurring_rules
+	WHERE id = $1
+	FOR UPDATE
+	`
+	err = scanRecurringRule(tx.QueryRow(query, id), rule)
+	if err != nil {
+		return 0, err
+	}
+
+	insertExpense := `
+	INSERT INTO expenses (user_id, amount, currency, account_id, category_id, note, date, recurring_rule_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (recurring_rule_id, date) DO NOTHING
+	`
+	insertIncome := `
+	INSERT INTO incomes (user_id, amount, currency, account_id, category_id, source, note, date, recurring_rule_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	ON CONFLICT (recurring_rule_id, date) DO NOTHING
+	`
+
+	created := 0
+	for next := rule.NextOccurrence(); next != nil && !next.After(now); next = rule.NextOccurrence() {
+		var result sql.Result
+		if rule.Type == "income" {
+			result, err = tx.Exec(insertIncome, rule.UserID, rule.Amount, rule.Currency, rule.AccountID, rule.CategoryID, rule.Source, rule.Note, *next, rule.ID)
+		} else {
+			result, err = tx.Exec(insertExpense, rule.UserID, rule.Amount, rule.Currency, rule.AccountID, rule.CategoryID, rule.Note, *next, rule.ID)
+		}
+		if err != nil {
+			return 0, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		created += int(rowsAffected)
+		rule.Occurrences++
+	}
+
+	_, err = tx.Exec(`UPDATE recurring_rules SET occurrences = $1, next_run = $2 WHERE id = $3`, rule.Occurrences, rule.NextOccurrence(), rule.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return created, nil
+}
@@ -0,0 +1,365 @@
+package store
+
+import (
+	"database/sql"
+	"math"
+	"time"
+)
+
+// SummaryBucket holds the totals of one month or year. Amounts are in the
+// user's base currency; transactions without a known exchange rate are left
+// out of the totals and counted in MissingRates.
+type SummaryBucket struct {
+	Period       string   `json:"period"` // "2024-01" or "2024"
+	Start        string   `json:"start"`  // first day of the period
+	Income       Money    `json:"income"`
+	Expense      Money    `json:"expense"`
+	Net          Money    `json:"net"`
+	SavingsRate  *float64 `json:"savings_rate"` // percent of income saved, nil without income
+	MissingRates int      `json:"missing_rates"`
+}
+
+type SummaryReport struct {
+	Period   string          `json:"period"` // month or year
+	From     string          `json:"from"`
+	To       string          `json:"to"`
+	Currency string          `json:"currency"`
+	Buckets  []SummaryBucket `json:"buckets"`
+	Total    SummaryBucket   `json:"total"`
+}
+
+// CategoryReportLine is the total of one category. Share is the percentage
+// of the report total. Previous is only set when a comparison window was
+// requested.
+type CategoryReportLine struct {
+	CategoryID int64               `json:"category_id"`
+	Category   string              `json:"category"`
+	Total      Money               `json:"total"`
+	Count      int                 `json:"count"`
+	Share      *float64            `json:"share"`
+	Previous   *CategoryComparison `json:"previous,omitempty"`
+}
+
+// CategoryComparison is the same category in the comparison window and the
+// change from there to the report window.
+type CategoryComparison struct {
+	Total         Money    `json:"total"`
+	Count         int      `json:"count"`
+	Change        Money    `json:"change"`
+	PercentChange *float64 `json:"percent_change"` // nil when the category was empty before
+}
+
+type CategoryReport struct {
+	Type         string               `json:"type"` // expense or income
+	From         string               `json:"from"`
+	To           string               `json:"to"`
+	CompareFrom  *string              `json:"compare_from,omitempty"`
+	CompareTo    *string              `json:"compare_to,omitempty"`
+	Currency     string               `json:"currency"`
+	Total        Money                `json:"total"`
+	Count        int                  `json:"count"`
+	CompareTotal *Money               `json:"compare_total,omitempty"`
+	MissingRates int                  `json:"missing_rates"`
+	Categories   []CategoryReportLine `json:"categories"`
+}
+
+// TagReportLine totals the transactions carrying one tag. A transaction with
+// several tags counts towards each of them.
+type TagReportLine struct {
+	TagID        int64  `json:"tag_id"`
+	Tag          string `json:"tag"`
+	Income       Money  `json:"income"`
+	Expense      Money  `json:"expense"`
+	Net          Money  `json:"net"`
+	Count        int    `json:"count"`
+	MissingRates int    `json:"missing_rates"`
+}
+
+type TagReport struct {
+	From     string          `json:"from"`
+	To       string          `json:"to"`
+	Currency string          `json:"currency"`
+	Tags     []TagReportLine `json:"tags"`
+}
+
+// percent returns part as a percentage of whole, rounded to two decimals,
+// or nil when whole is zero.
+func percent(part Money, whole Money) *float64 {
+	if whole == 0 {
+		return nil
+	}
+	p := math.Round(part.Float64()/whole.Float64()*10000) / 100
+	return &p
+}
+
+type PostgresReportStore struct {
+	db *sql.DB
+}
+
+func NewPostgresReportStore(db *sql.DB) *PostgresReportStore {
+	return &PostgresReportStore{
+		db: db,
+	}
+}
+
+type ReportStore interface {
+	GetSummaryReport(user_id int64, period string, from time.Time, to time.Time) (*SummaryReport, error)
+	GetCategoryReport(user_id int64, _type string, from time.Time, to time.Time, compareFrom *time.Time, compareTo *time.Time, parentID *int64, rollup bool) (*CategoryReport, error)
+	GetTagReport(user_id int64, from time.Time, to time.Time) (*TagReport, error)
+}
+
+// GetSummaryReport totals incomes and expenses per month or year between
+// from and to, both inclusive. Every period in the range gets a bucket, so
+// months without transactions show up as zeros. Transfers are not counted.
+func (pg *PostgresReportStore) GetSummaryReport(user_id int64, period string, from time.Time, to time.Time) (*SummaryReport, error) {
+	label := "YYYY-MM"
+	if period == "year" {
+		label = "YYYY"
+	}
+
+	query := `
+	WITH buckets AS (
+		SELECT generate_series(date_trunc($2, $3::timestamptz), date_trunc($2, $4::timestamptz), ('1 ' || $2)::interval) AS bucket
+	),
+	amounts AS (
+		SELECT date_trunc($2, e.date) AS bucket, 'expense' AS type, convert_amount(e.amount, e.currency, u.base_currency, e.date) AS amount
+		FROM expenses e
+		JOIN users u ON u.id = e.user_id
+		WHERE e.user_id = $1 AND e.date >= $3 AND e.date < $4::timestamptz + INTERVAL '1 day'
+
+		UNION ALL
+
+		SELECT date_trunc($2, i.date), 'income', convert_amount(i.amount, i.currency, u.base_currency, i.date)
+		FROM incomes i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.user_id = $1 AND i.date >= $3 AND i.date < $4::timestamptz + INTERVAL '1 day'
+	),
+	totals AS (
+		SELECT b.bucket,
+		COALESCE(SUM(a.amount) FILTER (WHERE a.type = 'income'), 0) AS income,
+		COALESCE(SUM(a.amount) FILTER (WHERE a.type = 'expense'), 0) AS expense,
+		COUNT(a.type) FILTER (WHERE a.amount IS NULL) AS missing_rates
+		FROM buckets b
+		LEFT JOIN amounts a ON a.bucket = b.bucket
+		GROUP BY b.bucket
+	)
+	SELECT to_char(bucket, $5), to_char(bucket, 'YYYY-MM-DD'), income, expense, income - expense,
+	ROUND((income - expense) / NULLIF(income, 0) * 100, 2)::float8, missing_rates
+	FROM totals
+	ORDER BY bucket
+	`
+	rows, err := pg.db.Query(query, user_id, period, from, to, label)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &SummaryReport{
+		Period:  period,
+		From:    from.Format("2006-01-02"),
+		To:      to.Format("2006-01-02"),
+		Buckets: []SummaryBucket{},
+		Total:   SummaryBucket{Period: "total", Start: from.Format("2006-01-02")},
+	}
+	for rows.Next() {
+		bucket := SummaryBucket{}
+		err := rows.Scan(&bucket.Period, &bucket.Start, &bucket.Income, &bucket.Expense, &bucket.Net, &bucket.SavingsRate, &bucket.MissingRates)
+		if err != nil {
+			return nil, err
+		}
+		report.Buckets = append(report.Buckets, bucket)
+
+		report.Total.Income += bucket.Income
+		report.Total.Expense += bucket.Expense
+		report.Total.Net += bucket.Net
+		report.Total.MissingRates += bucket.MissingRates
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	report.Total.SavingsRate = percent(report.Total.Net, report.Total.Income)
+
+	err = pg.db.QueryRow(`SELECT base_currency FROM users WHERE id = $1`, user_id).Scan(&report.Currency)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// GetCategoryReport totals expenses or incomes per category between from and
+// to, both inclusive, in the user's base currency. When a comparison window
+// is given every line also carries its total in that window, and categories
+// that only had transactions in the comparison window are listed with zero.
+//
+// parentID limits the report to that category and its descendants. With
+// rollup, subcategories are added into their top-level category, or into
+// the direct children of parentID when it is set.
+func (pg *PostgresReportStore) GetCategoryReport(user_id int64, _type string, from time.Time, to time.Time, compareFrom *time.Time, compareTo *time.Time, parentID *int64, rollup bool) (*CategoryReport, error) {
+	query := `
+	WITH RECURSIVE groups AS (
+		SELECT c.id, c.id AS group_id
+		FROM categories c
+		WHERE c.user_id = $1
+		AND (($7::bigint IS NULL AND c.parent_id IS NULL) OR c.id = $7 OR c.parent_id = $7)
+
+		UNION ALL
+
+		SELECT c.id, g.group_id
+		FROM categories c
+		JOIN groups g ON c.parent_id = g.id
+		WHERE g.id IS DISTINCT FROM $7
+	),
+	amounts AS (
+		-- split expenses count once per split, on the split's category
+		SELECT COALESCE(s.category_id, e.category_id) AS category_id, e.date,
+		convert_amount(COALESCE(s.amount, e.amount), e.currency, u.base_currency, e.date) AS amount
+		FROM expenses e
+		JOIN users u ON u.id = e.user_id
+		LEFT JOIN expense_splits s ON s.expense_id = e.id
+		WHERE e.user_id = $1 AND $2 = 'expense'
+
+		UNION ALL
+
+		SELECT i.category_id, i.date, convert_amount(i.amount, i.currency, u.base_currency, i.date)
+		FROM incomes i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.user_id = $1 AND $2 = 'income'
+	),
+	windows AS (
+		SELECT CASE WHEN $8::boolean THEN g.group_id ELSE g.id END AS category_id, a.amount,
+		date >= $3::timestamptz AND date < $4::timestamptz + INTERVAL '1 day' AS current,
+		$5::timestamptz IS NOT NULL AND date >= $5::timestamptz AND date < $6::timestamptz + INTERVAL '1 day' AS previous
+		FROM amounts a
+		JOIN groups g ON g.id = a.category_id
+	)
+	SELECT c.id, category_path(c.id),
+	COALESCE(SUM(w.amount) FILTER (WHERE w.current), 0),
+	COUNT(*) FILTER (WHERE w.current),
+	COALESCE(SUM(w.amount) FILTER (WHERE w.previous), 0),
+	COUNT(*) FILTER (WHERE w.previous),
+	COUNT(*) FILTER (WHERE w.current AND w.amount IS NULL)
+	FROM windows w
+	JOIN categories c ON c.id = w.category_id
+	WHERE w.current OR w.previous
+	GROUP BY c.id
+	ORDER BY 3 DESC, 2
+	`
+	rows, err := pg.db.Query(query, user_id, _type, from, to, compareFrom, compareTo, parentID, rollup)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &CategoryReport{
+		Type:       _type,
+		From:       from.Format("2006-01-02"),
+		To:         to.Format("2006-01-02"),
+		Categories: []CategoryReportLine{},
+	}
+	compare := compareFrom != nil && compareTo != nil
+	var compareTotal Money
+	for rows.Next() {
+		line := CategoryReportLine{}
+		previous := CategoryComparison{}
+		var missingRates int
+		err := rows.Scan(&line.CategoryID, &line.Category, &line.Total, &line.Count, &previous.Total, &previous.Count, &missingRates)
+		if err != nil {
+			return nil, err
+		}
+		if compare {
+			previous.Change = line.Total - previous.Total
+			previous.PercentChange = percent(previous.Change, previous.Total)
+			line.Previous = &previous
+		}
+		report.Categories = append(report.Categories, line)
+
+		report.Total += line.Total
+		report.Count += line.Count
+		report.MissingRates += missingRates
+		compareTotal += previous.Total
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range report.Categories {
+		report.Categories[i].Share = percent(report.Categories[i].Total, report.Total)
+	}
+	if compare {
+		compareFromStr := compareFrom.Format("2006-01-02")
+		compareToStr := compareTo.Format("2006-01-02")
+		report.CompareFrom = &compareFromStr
+		report.CompareTo = &compareToStr
+		report.CompareTotal = &compareTotal
+	}
+
+	err = pg.db.QueryRow(`SELECT base_currency FROM users WHERE id = $1`, user_id).Scan(&report.Currency)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// GetTagReport totals incomes and expenses per tag between from and to, both
+// inclusive, in the user's base currency. Tags without transactions in the
+// range are left out.
+func (pg *PostgresReportStore) GetTagReport(user_id int64, from time.Time, to time.Time) (*TagReport, error) {
+	query := `
+	WITH amounts AS (
+		SELECT et.tag_id, 'expense' AS type, convert_amount(e.amount, e.currency, u.base_currency, e.date) AS amount
+		FROM expenses e
+		JOIN expense_tags et ON et.expense_id = e.id
+		JOIN users u ON u.id = e.user_id
+		WHERE e.user_id = $1 AND e.date >= $2 AND e.date < $3::timestamptz + INTERVAL '1 day'
+
+		UNION ALL
+
+		SELECT it.tag_id, 'income', convert_amount(i.amount, i.currency, u.base_currency, i.date)
+		FROM incomes i
+		JOIN income_tags it ON it.income_id = i.id
+		JOIN users u ON u.id = i.user_id
+		WHERE i.user_id = $1 AND i.date >= $2 AND i.date < $3::timestamptz + INTERVAL '1 day'
+	),
+	totals AS (
+		SELECT t.id, t.name,
+		COALESCE(SUM(a.amount) FILTER (WHERE a.type = 'income'), 0) AS income,
+		COALESCE(SUM(a.amount) FILTER (WHERE a.type = 'expense'), 0) AS expense,
+		COUNT(*) AS count,
+		COUNT(*) FILTER (WHERE a.amount IS NULL) AS missing_rates
+		FROM amounts a
+		JOIN tags t ON t.id = a.tag_id
+		GROUP BY t.id, t.name
+	)
+	SELECT id, name, income, expense, income - expense, count, missing_rates
+	FROM totals
+	ORDER BY expense DESC, name
+	`
+	rows, err := pg.db.Query(query, user_id, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &TagReport{
+		From: from.Format("2006-01-02"),
+		To:   to.Format("2006-01-02"),
+		Tags: []TagReportLine{},
+	}
+	for rows.Next() {
+		line := TagReportLine{}
+		err := rows.Scan(&line.TagID, &line.Tag, &line.Income, &line.Expense, &line.Net, &line.Count, &line.MissingRates)
+		if err != nil {
+			return nil, err
+		}
+		report.Tags = append(report.Tags, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = pg.db.QueryRow(`SELECT base_currency FROM users WHERE id = $1`, user_id).Scan(&report.Currency)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
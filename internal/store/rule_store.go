@@ -0,0 +1,236 @@
+package store
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+// RuleConditions must all hold for a rule to match. Unset conditions match
+// everything; text conditions are case-insensitive substrings.
+type RuleConditions struct {
+	Type          *string `json:"type,omitempty"` // expense or income
+	NoteContains  *string `json:"note_contains,omitempty"`
+	PayeeContains *string `json:"payee_contains,omitempty"`
+	MinAmount     *Money  `json:"min_amount,omitempty"`
+	MaxAmount     *Money  `json:"max_amount,omitempty"`
+	AccountID     *int64  `json:"account_id,omitempty"`
+}
+
+func (c *RuleConditions) Scan(src any) error {
+	return scanJSON(src, c)
+}
+
+func (c RuleConditions) Value() (driver.Value, error) {
+	return json.Marshal(c)
+}
+
+// RuleActions are applied to a matching transaction.
+type RuleActions struct {
+	SetCategory *string  `json:"set_category,omitempty"` // category path
+	AddTags     []string `json:"add_tags,omitempty"`
+	SetPayee    *string  `json:"set_payee,omitempty"`
+}
+
+func (a *RuleActions) Scan(src any) error {
+	return scanJSON(src, a)
+}
+
+func (a RuleActions) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+// Rule categorizes transactions automatically. Rules run by ascending
+// priority.
+type Rule struct {
+	ID         int64          `json:"id"`
+	UserID     int64          `json:"user_id"`
+	Name       string         `json:"name"`
+	Priority   int            `json:"priority"`
+	Conditions RuleConditions `json:"conditions"`
+	Actions    RuleActions    `json:"actions"`
+	Enabled    bool           `json:"enabled"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// RuleChange is what applying the rules does to one stored transaction.
+// Only the fields that change are set.
+type RuleChange struct {
+	Type       string   `json:"type"` // expense or income
+	ID         int64    `json:"id"`
+	Note       string   `json:"note"`
+	RuleIDs    []int64  `json:"rule_ids"`
+	Category   *string  `json:"category,omitempty"`
+	CategoryID *int64   `json:"category_id,omitempty"`
+	AddTags    []string `json:"add_tags,omitempty"`
+	Payee      *string  `json:"payee,omitempty"`
+	PayeeID    *int64   `json:"payee_id,omitempty"`
+}
+
+type PostgresRuleStore struct {
+	db *sql.DB
+}
+
+func NewPostgresRuleStore(db *sql.DB) *PostgresRuleStore {
+	return &PostgresRuleStore{
+		db: db,
+	}
+}
+
+type RuleStore interface {
+	CreateRule(rule *Rule) (*Rule, error)
+	GetRuleByID(id int64) (*Rule, error)
+	GetRules(user_id int64) ([]Rule, error)
+	UpdateRule(rule *Rule) error
+	DeleteRuleByID(id int64) error
+
+	ApplyRuleChanges(user_id int64, changes []RuleChange) error
+}
+
+const ruleColumns = `id, user_id, name, priority, conditions, actions, enabled, created_at, updated_at`
+
+func scanRule(row rowScanner, rule *Rule) error {
+	return row.Scan(&rule.ID, &rule.UserID, &rule.Name, &rule.Priority, &rule.Conditions, &rule.Actions, &rule.Enabled, &rule.CreatedAt, &rule.UpdatedAt)
+}
+
+func (pg *PostgresRuleStore) CreateRule(rule *Rule) (*Rule, error) {
+	query := `
+	INSERT INTO rules (user_id, name, priority, conditions, actions, enabled)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at, updated_at
+	`
+	err := pg.db.QueryRow(query, rule.UserID, rule.Name, rule.Priority, rule.Conditions, rule.Actions, rule.Enabled).Scan(&rule.ID, &rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (pg *PostgresRuleStore) GetRuleByID(id int64) (*Rule, error) {
+	rule := &Rule{}
+	query := `SELECT ` + ruleColumns + `
+	FROM rules
+	WHERE id = $1
+	`
+	err := scanRule(pg.db.QueryRow(query, id), rule)
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// GetRules returns the user's rules in the order they are applied.
+func (pg *PostgresRuleStore) GetRules(user_id int64) ([]Rule, error) {
+	query := `SELECT ` + ruleColumns + `
+	FROM rules
+	WHERE user_id = $1
+	ORDER BY priority, id
+	`
+	rows, err := pg.db.Query(query, user_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []Rule{}
+	for rows.Next() {
+		var rule Rule
+		err := scanRule(rows, &rule)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (pg *PostgresRuleStore) UpdateRule(rule *Rule) error {
+	query := `
+	UPDATE rules
+	SET name = $1, priority = $2, conditions = $3, actions = $4, enabled = $5, updated_at = $6
+	WHERE id = $7
+	`
+	result, err := pg.db.Exec(query, rule.Name, rule.Priority, rule.Conditions, rule.Actions, rule.Enabled, rule.UpdatedAt, rule.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (pg *PostgresRuleStore) DeleteRuleByID(id int64) error {
+	result, err := pg.db.Exec(`DELETE FROM rules WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ApplyRuleChanges saves the changes found by re-running the rules over
+// stored transactions, all or nothing. Category and payee ids must already
+// be resolved; tags are added to the ones a transaction has.
+func (pg *PostgresRuleStore) ApplyRuleChanges(user_id int64, changes []RuleChange) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, change := range changes {
+		table, joinTable, column := "expenses", "expense_tags", "expense_id"
+		if change.Type == "income" {
+			table, joinTable, column = "incomes", "income_tags", "income_id"
+		}
+
+		query := `
+		UPDATE ` + table + `
+		SET category_id = COALESCE($1, category_id), payee_id = COALESCE($2, payee_id), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND user_id = $4
+		`
+		_, err := tx.Exec(query, change.CategoryID, change.PayeeID, change.ID, user_id)
+		if err != nil {
+			return err
+		}
+
+		if len(change.AddTags) == 0 {
+			continue
+		}
+		query = `
+		INSERT INTO tags (user_id, name)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT (user_id, name) DO NOTHING
+		`
+		_, err = tx.Exec(query, user_id, change.AddTags)
+		if err != nil {
+			return err
+		}
+		query = `
+		INSERT INTO ` + joinTable + ` (` + column + `, tag_id)
+		SELECT $1, id FROM tags
+		WHERE user_id = $2 AND name = ANY($3)
+		ON CONFLICT DO NOTHING
+		`
+		_, err = tx.Exec(query, change.ID, user_id, change.AddTags)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
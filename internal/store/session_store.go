@@ -0,0 +1,261 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+// ErrRefreshTokenReused means a refresh token was presented a second time.
+// Either the client or an attacker holds a stolen copy, so the session it
+// belonged to has been revoked.
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+// NewToken returns a random opaque token for the client and the hash of it
+// that is stored instead.
+func NewToken() (string, []byte, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+	return token, HashToken(token), nil
+}
+
+// HashToken hashes a token made by NewToken. The tokens are random, so a
+// plain SHA-256 is enough, unlike for passwords.
+func HashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+// Session is one login of a user, kept alive by refreshing it. The device
+// it was last refreshed from is recorded so users can tell sessions apart.
+type Session struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	Current    bool       `json:"current"` // whether the request was made with this session
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+type PostgresSessionStore struct {
+	db *sql.DB
+}
+
+func NewPostgresSessionStore(db *sql.DB) *PostgresSessionStore {
+	return &PostgresSessionStore{
+		db: db,
+	}
+}
+
+type SessionStore interface {
+	CreateSession(session *Session, tokenHash []byte) (*Session, error)
+	RotateRefreshToken(tokenHash []byte, newTokenHash []byte, device *Session) (*Session, error)
+	IsSessionActive(id int64, user_id int64) (bool, error)
+	GetSessionByID(id int64) (*Session, error)
+	GetSessions(user_id int64) ([]Session, error)
+	RevokeSession(id int64) error
+	RevokeUserSessions(user_id int64) error
+}
+
+// CreateSession starts a session with its first refresh token. Expired
+// sessions of the user are cleaned up on the way.
+func (pg *PostgresSessionStore) CreateSession(session *Session, tokenHash []byte) (*Session, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM sessions WHERE user_id = $1 AND expires_at < CURRENT_TIMESTAMP`, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	INSERT INTO sessions (user_id, user_agent, ip_address, expires_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, last_seen_at, created_at, updated_at
+	`
+	err = tx.QueryRow(query, session.UserID, session.UserAgent, session.IPAddress, session.ExpiresAt).Scan(&session.ID, &session.LastSeenAt, &session.CreatedAt, &session.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO refresh_tokens (session_id, token_hash) VALUES ($1, $2)`, session.ID, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// RotateRefreshToken trades a refresh token for a new one, extends the
+// session to device.ExpiresAt and records the device's user agent and IP
+// address as last seen now. Unknown tokens and tokens of expired or revoked
+// sessions give sql.ErrNoRows; a token that was used before revokes its
+// session and gives ErrRefreshTokenReused.
+func (pg *PostgresSessionStore) RotateRefreshToken(tokenHash []byte, newTokenHash []byte, device *Session) (*Session, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	session := &Session{}
+	var tokenID int64
+	var usedAt *time.Time
+	query := `
+	SELECT rt.id, rt.used_at, s.id, s.user_id, s.expires_at, s.revoked_at, s.created_at
+	FROM refresh_tokens rt
+	JOIN sessions s ON s.id = rt.session_id
+	WHERE rt.token_hash = $1
+	FOR UPDATE OF rt, s
+	`
+	err = tx.QueryRow(query, tokenHash).Scan(&tokenID, &usedAt, &session.ID, &session.UserID, &session.ExpiresAt, &session.RevokedAt, &session.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if session.RevokedAt != nil || session.ExpiresAt.Before(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+
+	if usedAt != nil {
+		_, err = tx.Exec(`UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, session.ID)
+		if err != nil {
+			return nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	_, err = tx.Exec(`UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1`, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`INSERT INTO refresh_tokens (session_id, token_hash) VALUES ($1, $2)`, session.ID, newTokenHash)
+	if err != nil {
+		return nil, err
+	}
+	query = `
+	UPDATE sessions
+	SET expires_at = $1, user_agent = $2, ip_address = $3, last_seen_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $4
+	RETURNING ` + sessionColumns
+	err = scanSession(tx.QueryRow(query, device.ExpiresAt, device.UserAgent, device.IPAddress, session.ID), session)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+const sessionColumns = `id, user_id, user_agent, ip_address, last_seen_at, expires_at, revoked_at, created_at, updated_at`
+
+func scanSession(row rowScanner, session *Session) error {
+	return row.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress, &session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt, &session.CreatedAt, &session.UpdatedAt)
+}
+
+func (pg *PostgresSessionStore) GetSessionByID(id int64) (*Session, error) {
+	session := &Session{}
+	query := `SELECT ` + sessionColumns + `
+	FROM sessions
+	WHERE id = $1
+	`
+	err := scanSession(pg.db.QueryRow(query, id), session)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetSessions lists the user's sessions that are still usable, most
+// recently seen first.
+func (pg *PostgresSessionStore) GetSessions(user_id int64) ([]Session, error) {
+	query := `SELECT ` + sessionColumns + `
+	FROM sessions
+	WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+	ORDER BY last_seen_at DESC, id DESC
+	`
+	rows, err := pg.db.Query(query, user_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		err := scanSession(rows, &session)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// IsSessionActive reports whether the session belongs to the user and is
+// neither revoked nor expired.
+func (pg *PostgresSessionStore) IsSessionActive(id int64, user_id int64) (bool, error) {
+	var active bool
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM sessions
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+	)
+	`
+	err := pg.db.QueryRow(query, id, user_id).Scan(&active)
+	return active, err
+}
+
+func (pg *PostgresSessionStore) RevokeSession(id int64) error {
+	query := `
+	UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND revoked_at IS NULL
+	`
+	result, err := pg.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RevokeUserSessions logs the user out everywhere.
+func (pg *PostgresSessionStore) RevokeUserSessions(user_id int64) error {
+	query := `
+	UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND revoked_at IS NULL
+	`
+	_, err := pg.db.Exec(query, user_id)
+	return err
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var ErrSplitTotal = errors.New("splits must add up to the expense amount")
+
+// Split is the part of an expense booked on one category. Category is the
+// category path; on input it is resolved to CategoryID by the handler.
+type Split struct {
+	ID         int64   `json:"id"`
+	CategoryID int64   `json:"category_id"`
+	Category   *string `json:"category,omitempty"`
+	Amount     Money   `json:"amount"`
+	Note       string  `json:"note"`
+}
+
+// SplitList is the splits of one expense. It scans the JSON array built by
+// splitsColumn.
+type SplitList []Split
+
+func (s *SplitList) Scan(src any) error {
+	*s = SplitList{}
+	return scanJSON(src, s)
+}
+
+// CheckSplits verifies that splits cover the amount exactly. An expense
+// without splits is always fine.
+func CheckSplits(amount Money, splits SplitList) error {
+	if len(splits) == 0 {
+		return nil
+	}
+	var total Money
+	for _, split := range splits {
+		if split.Amount <= 0 {
+			return errors.New("split amounts must be positive")
+		}
+		total += split.Amount
+	}
+	if total != amount {
+		return ErrSplitTotal
+	}
+	return nil
+}
+
+// splitsColumn selects the splits of a row of expenses as a JSON array.
+func splitsColumn(row string) string {
+	return `COALESCE((
+		SELECT json_agg(json_build_object(
+			'id', s.id, 'category_id', s.category_id, 'category', category_path(s.category_id),
+			'amount', s.amount::text, 'note', COALESCE(s.note, '')
+		) ORDER BY s.id)
+		FROM expense_splits s
+		WHERE s.expense_id = ` + row + `.id
+	), '[]')`
+}
+
+// setSplits replaces the splits of an expense.
+func setSplits(tx *sql.Tx, expenseID int64, splits SplitList) error {
+	_, err := tx.Exec(`DELETE FROM expense_splits WHERE expense_id = $1`, expenseID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO expense_splits (expense_id, category_id, amount, note)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id
+	`
+	for i := range splits {
+		err := tx.QueryRow(query, expenseID, splits[i].CategoryID, splits[i].Amount, splits[i].Note).Scan(&splits[i].ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
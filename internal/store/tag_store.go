@@ -0,0 +1,138 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+type Tag struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	Count     int       `json:"count"` // expenses and incomes carrying the tag
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TagList is the tag names of one transaction. It scans the JSON array built
+// by tagsColumn.
+type TagList []string
+
+func (t *TagList) Scan(src any) error {
+	*t = TagList{}
+	return scanJSON(src, t)
+}
+
+// scanJSON decodes a json column into dest. NULL leaves dest as it is.
+func scanJSON(src any, dest any) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	case []byte:
+		return json.Unmarshal(v, dest)
+	case nil:
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into %T", src, dest)
+	}
+}
+
+// NormalizeTags lower-cases and trims tag names, drops empty ones and
+// duplicates, and sorts them.
+func NormalizeTags(tags []string) TagList {
+	normalized := TagList{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	slices.Sort(normalized)
+	return normalized
+}
+
+// tagsColumn selects the sorted tag names of a row of expenses or incomes as
+// a JSON array. joinTable and column are always our own names.
+func tagsColumn(joinTable string, column string, row string) string {
+	return `COALESCE((
+		SELECT json_agg(t.name ORDER BY t.name)
+		FROM ` + joinTable + ` jt
+		JOIN tags t ON t.id = jt.tag_id
+		WHERE jt.` + column + ` = ` + row + `.id
+	), '[]')`
+}
+
+// setTags replaces the tags of one expense or income, creating tags the
+// user did not have yet. joinTable and column are always our own names.
+func setTags(tx *sql.Tx, joinTable string, column string, id int64, user_id int64, tags TagList) error {
+	_, err := tx.Exec(`DELETE FROM `+joinTable+` WHERE `+column+` = $1`, id)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	query := `
+	INSERT INTO tags (user_id, name)
+	SELECT $1, unnest($2::text[])
+	ON CONFLICT (user_id, name) DO NOTHING
+	`
+	_, err = tx.Exec(query, user_id, []string(tags))
+	if err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO ` + joinTable + ` (` + column + `, tag_id)
+	SELECT $1, id FROM tags
+	WHERE user_id = $2 AND name = ANY($3)
+	`
+	_, err = tx.Exec(query, id, user_id, []string(tags))
+	return err
+}
+
+type PostgresTagStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTagStore(db *sql.DB) *PostgresTagStore {
+	return &PostgresTagStore{
+		db: db,
+	}
+}
+
+type TagStore interface {
+	GetTags(user_id int64) ([]Tag, error)
+}
+
+// GetTags lists the user's tags by name with how often each one is used.
+func (pg *PostgresTagStore) GetTags(user_id int64) ([]Tag, error) {
+	query := `
+	SELECT t.id, t.user_id, t.name,
+	(SELECT COUNT(*) FROM expense_tags et WHERE et.tag_id = t.id) + (SELECT COUNT(*) FROM income_tags it WHERE it.tag_id = t.id),
+	t.created_at
+	FROM tags t
+	WHERE t.user_id = $1
+	ORDER BY t.name
+	`
+	rows, err := pg.db.Query(query, user_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		var tag Tag
+		err := rows.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.Count, &tag.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
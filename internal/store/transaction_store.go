@@ -3,46 +3,92 @@ package store
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 )
 
 type Expense struct {
 	ID         int64      `json:"id"`
 	UserID     int64      `json:"user_id"`
-	Amount     float64    `json:"amount"`
+	Amount     Money      `json:"amount"`
+	Currency   string     `json:"currency"`
+	AccountID  *int64     `json:"account_id,omitempty"`
 	CategoryID int64      `json:"category_id"`
 	Category   *string    `json:"category,omitempty"`
+	PayeeID    *int64     `json:"payee_id,omitempty"`
+	Payee      *string    `json:"payee,omitempty"`
 	Note       string     `json:"note"`
+	Tags       TagList    `json:"tags"`
+	Splits     SplitList  `json:"splits,omitempty"` // categories the amount is divided between
 	Date       *time.Time `json:"date"`
-	CreatedAt  time.Time  `json:"created_at"`
-	UpdatedAt  time.Time  `json:"updated_at"`
+	// set when the expense was posted by a recurring rule
+	RecurringRuleID *int64 `json:"recurring_rule_id,omitempty"`
+	// set when the expense was imported from a bank statement
+	ExternalID *string   `json:"external_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
 }
 
 type Income struct {
 	ID         int64      `json:"id"`
 	UserID     int64      `json:"user_id"`
-	Amount     float64    `json:"amount"`
+	Amount     Money      `json:"amount"`
+	Currency   string     `json:"currency"`
+	AccountID  *int64     `json:"account_id,omitempty"`
 	CategoryID int64      `json:"category_id"`
 	Category   *string    `json:"category,omitempty"`
-	Source     string     `json:"source"`
+	PayerID    *int64     `json:"payer_id,omitempty"`
+	Payer      *string    `json:"payer,omitempty"`
+	Source     string     `json:"source"` // free text, superseded by Payer
 	Note       string     `json:"note"`
+	Tags       TagList    `json:"tags"`
 	Date       *time.Time `json:"date"`
-	CreatedAt  time.Time  `json:"created_at"`
-	UpdatedAt  time.Time  `json:"updated_at"`
+	// set when the income was posted by a recurring rule
+	RecurringRuleID *int64 `json:"recurring_rule_id,omitempty"`
+	// set when the income was imported from a bank statement
+	ExternalID *string   `json:"external_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
 }
 
 type Transaction struct {
-	ID         int64     `json:"id"`
-	UserID     int64     `json:"user_id"`
-	Amount     float64   `json:"amount"`
-	CategoryID int64     `json:"category_id"`
-	Category   *string   `json:"category,omitempty"`
-	Note       string    `json:"note"`
-	Source     *string   `json:"source"` // for incomes
-	Type       string    `json:"type"`   // income or expense
-	Date       time.Time `json:"date"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"user_id"`
+	Amount      Money     `json:"amount"`
+	Currency    string    `json:"currency"`
+	AccountID   *int64    `json:"account_id,omitempty"`    // source account for transfers
+	ToAccountID *int64    `json:"to_account_id,omitempty"` // for transfers
+	CategoryID  *int64    `json:"category_id"`             // nil for transfers
+	Category    *string   `json:"category,omitempty"`
+	Note        string    `json:"note"`
+	Source      *string   `json:"source"`          // for incomes
+	Payee       *string   `json:"payee,omitempty"` // payee of an expense or payer of an income
+	Type        string    `json:"type"`            // income, expense or transfer
+	Tags        TagList   `json:"tags"`
+	Date        time.Time `json:"date"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	// set when the recurring worker posted it
+	RecurringRuleID *int64 `json:"recurring_rule_id,omitempty"`
+	// only set when the amount was converted to the user's base currency
+	BaseAmount   *Money  `json:"base_amount,omitempty"`
+	BaseCurrency *string `json:"base_currency,omitempty"`
+	RateMissing  bool    `json:"rate_missing,omitempty"`
+}
+
+type CurrencyTotal struct {
+	Currency string `json:"currency"`
+	Total    Money  `json:"total"`
+}
+
+// ConvertedTotal is a sum in a single currency. Transactions in other
+// currencies are converted with the rate effective on their date; those
+// without a known rate are counted in MissingRates and left out of Total.
+type ConvertedTotal struct {
+	Currency     string          `json:"currency"`
+	Total        Money           `json:"total"`
+	ByCurrency   []CurrencyTotal `json:"by_currency"`
+	MissingRates int             `json:"missing_rates"`
 }
 
 type PostgresTransactionStore struct {
@@ -61,16 +107,25 @@ type TransactionStore interface {
 	UpdateExpense(expense *Expense) error
 	DeleteExpenseByID(id int64) error
 	GetExpenses(user_id int64, limit int, offset int) ([]Expense, error)
-	GetTotalExpenses(user_id int64) (float64, error)
+	GetTotalExpenses(user_id int64) (Money, error)
+	GetTotalExpensesConverted(user_id int64, baseCurrency string) (*ConvertedTotal, error)
 
 	CreateIncome(income *Income) (*Income, error)
 	GetIncomeByID(id int64) (*Income, error)
 	UpdateIncome(income *Income) error
 	DeleteIncomeByID(id int64) error
 	GetIncomes(user_id int64, limit int, offset int) ([]Income, error)
-	GetTotalIncomes(user_id int64) (float64, error)
+	GetTotalIncomes(user_id int64) (Money, error)
+	GetTotalIncomesConverted(user_id int64, baseCurrency string) (*ConvertedTotal, error)
+
+	GetTransactions(user_id int64, limit int, offset int, filter TransactionFilter, baseCurrency *string) ([]Transaction, error)
+	StreamTransactions(user_id int64, filter TransactionFilter, fn func(transaction *Transaction) error) error
+	StreamExpenses(user_id int64, fn func(expense *Expense) error) error
+	GetDuplicateCandidates(user_id int64, days int) ([]Transaction, error)
+	GetExpensesNear(user_id int64, amount Money, currency string, date time.Time, days int) ([]Transaction, error)
 
-	GetTransactions(user_id int64, limit int, offset int, from *time.Time, to *time.Time, month *int, year *int, _type *string, category *int64) ([]Transaction, error)
+	ImportTransactions(expenses []*Expense, incomes []*Income) (int, error)
+	GetImportedExternalIDs(user_id int64, externalIDs []string) (map[string]bool, error)
 }
 
 func (pg *PostgresTransactionStore) CreateExpense(expense *Expense) (*Expense, error) {
@@ -82,11 +137,19 @@ func (pg *PostgresTransactionStore) CreateExpense(expense *Expense) (*Expense, e
 	defer tx.Rollback()
 
 	query := `
-	INSERT INTO expenses (user_id, amount, category_id, note, date)
-	VALUES ($1, $2, $3, $4, $5)
+	INSERT INTO expenses (user_id, amount, currency, account_id, category_id, payee_id, note, date)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	RETURNING id, created_at, updated_at
 	`
-	err = tx.QueryRow(query, expense.UserID, expense.Amount, expense.CategoryID, expense.Note, expense.Date).Scan(&expense.ID, &expense.CreatedAt, &expense.UpdatedAt)
+	err = tx.QueryRow(query, expense.UserID, expense.Amount, expense.Currency, expense.AccountID, expense.CategoryID, expense.PayeeID, expense.Note, expense.Date).Scan(&expense.ID, &expense.CreatedAt, &expense.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	err = setTags(tx, "expense_tags", "expense_id", expense.ID, expense.UserID, expense.Tags)
+	if err != nil {
+		return nil, err
+	}
+	err = setSplits(tx, expense.ID, expense.Splits)
 	if err != nil {
 		return nil, err
 	}
@@ -101,11 +164,11 @@ func (pg *PostgresTransactionStore) GetExpenseByID(id int64) (*Expense, error) {
 	expense := &Expense{}
 
 	query := `
-	SELECT id, user_id, amount, category_id, note, date, created_at, updated_at
+	SELECT id, user_id, amount, currency, account_id, category_id, payee_id, ` + payeeColumn("expenses") + `, note, ` + tagsColumn("expense_tags", "expense_id", "expenses") + `, ` + splitsColumn("expenses") + `, date, recurring_rule_id, external_id, created_at, updated_at
 	FROM expenses
 	WHERE id = $1
 	`
-	err := pg.db.QueryRow(query, id).Scan(&expense.ID, &expense.UserID, &expense.Amount, &expense.CategoryID, &expense.Note, &expense.Date, &expense.CreatedAt, &expense.UpdatedAt)
+	err := pg.db.QueryRow(query, id).Scan(&expense.ID, &expense.UserID, &expense.Amount, &expense.Currency, &expense.AccountID, &expense.CategoryID, &expense.PayeeID, &expense.Payee, &expense.Note, &expense.Tags, &expense.Splits, &expense.Date, &expense.RecurringRuleID, &expense.ExternalID, &expense.CreatedAt, &expense.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -121,10 +184,10 @@ func (pg *PostgresTransactionStore) UpdateExpense(expense *Expense) error {
 	defer tx.Rollback()
 	query := `
     UPDATE expenses
-    SET amount = $1, category_id = $2, note = $3, date = $4, updated_at = $5
-    WHERE id = $6
+    SET amount = $1, currency = $2, account_id = $3, category_id = $4, payee_id = $5, note = $6, date = $7, updated_at = $8
+    WHERE id = $9
     `
-	result, err := tx.Exec(query, expense.Amount, expense.CategoryID, expense.Note, expense.Date, expense.UpdatedAt, expense.ID)
+	result, err := tx.Exec(query, expense.Amount, expense.Currency, expense.AccountID, expense.CategoryID, expense.PayeeID, expense.Note, expense.Date, expense.UpdatedAt, expense.ID)
 	if err != nil {
 		return err
 	}
@@ -137,6 +200,15 @@ func (pg *PostgresTransactionStore) UpdateExpense(expense *Expense) error {
 	if rowsAffected == 0 {
 		return sql.ErrNoRows
 	}
+
+	err = setTags(tx, "expense_tags", "expense_id", expense.ID, expense.UserID, expense.Tags)
+	if err != nil {
+		return err
+	}
+	err = setSplits(tx, expense.ID, expense.Splits)
+	if err != nil {
+		return err
+	}
 	return tx.Commit()
 }
 
@@ -170,11 +242,15 @@ func (pg *PostgresTransactionStore) CreateIncome(income *Income) (*Income, error
 	defer tx.Rollback()
 
 	query := `
-    INSERT INTO incomes (user_id, amount, category_id, source, note, date)
-    VALUES ($1, $2, $3, $4, $5, $6)
+    INSERT INTO incomes (user_id, amount, currency, account_id, category_id, payee_id, source, note, date)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
     RETURNING id, created_at, updated_at
 	`
-	err = pg.db.QueryRow(query, income.UserID, income.Amount, income.CategoryID, income.Source, income.Note, income.Date).Scan(&income.ID, &income.CreatedAt, &income.UpdatedAt)
+	err = tx.QueryRow(query, income.UserID, income.Amount, income.Currency, income.AccountID, income.CategoryID, income.PayerID, income.Source, income.Note, income.Date).Scan(&income.ID, &income.CreatedAt, &income.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	err = setTags(tx, "income_tags", "income_id", income.ID, income.UserID, income.Tags)
 	if err != nil {
 		return nil, err
 	}
@@ -189,11 +265,11 @@ func (pg *PostgresTransactionStore) GetIncomeByID(id int64) (*Income, error) {
 	income := &Income{}
 
 	query := `
-    SELECT id, user_id, amount, category_id, source, note, date, created_at, updated_at
+    SELECT id, user_id, amount, currency, account_id, category_id, payee_id, ` + payeeColumn("incomes") + `, source, note, ` + tagsColumn("income_tags", "income_id", "incomes") + `, date, recurring_rule_id, external_id, created_at, updated_at
     FROM incomes
     WHERE id = $1
     `
-	err := pg.db.QueryRow(query, id).Scan(&income.ID, &income.UserID, &income.Amount, &income.CategoryID, &income.Source, &income.Note, &income.Date, &income.CreatedAt, &income.UpdatedAt)
+	err := pg.db.QueryRow(query, id).Scan(&income.ID, &income.UserID, &income.Amount, &income.Currency, &income.AccountID, &income.CategoryID, &income.PayerID, &income.Payer, &income.Source, &income.Note, &income.Tags, &income.Date, &income.RecurringRuleID, &income.ExternalID, &income.CreatedAt, &income.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -209,10 +285,13 @@ func (pg *PostgresTransactionStore) UpdateIncome(income *Income) error {
 	defer tx.Rollback()
 	query := `
     UPDATE incomes
-    SET amount = $1, category_id = $2, source = $3, note = $4, date = $5, updated_at = $6
-    WHERE id = $7
+    SET amount = $1, currency = $2, account_id = $3, category_id = $4, payee_id = $5, source = $6, note = $7, date = $8, updated_at = $9
+    WHERE id = $10
     `
-	result, err := tx.Exec(query, income.Amount, income.CategoryID, income.Source, income.Note, income.Date, income.UpdatedAt, income.ID)
+	result, err := tx.Exec(query, income.Amount, income.Currency, income.AccountID, income.CategoryID, income.PayerID, income.Source, income.Note, income.Date, income.UpdatedAt, income.ID)
+	if err != nil {
+		return err
+	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
@@ -222,6 +301,10 @@ func (pg *PostgresTransactionStore) UpdateIncome(income *Income) error {
 		return sql.ErrNoRows
 	}
 
+	err = setTags(tx, "income_tags", "income_id", income.ID, income.UserID, income.Tags)
+	if err != nil {
+		return err
+	}
 	return tx.Commit()
 }
 
@@ -248,7 +331,8 @@ func (pg *PostgresTransactionStore) DeleteIncomeByID(id int64) error {
 func (pg *PostgresTransactionStore) GetExpenses(user_id int64, limit int, offset int) ([]Expense, error) {
 
 	query := `
-	SELECT * FROM expenses
+	SELECT id, user_id, amount, currency, account_id, category_id, payee_id, ` + payeeColumn("expenses") + `, note, ` + tagsColumn("expense_tags", "expense_id", "expenses") + `, ` + splitsColumn("expenses") + `, date, recurring_rule_id, external_id, created_at, updated_at
+	FROM expenses
 	WHERE user_id = $1
 	ORDER BY date DESC LIMIT $2 OFFSET $3
 	`
@@ -261,7 +345,7 @@ func (pg *PostgresTransactionStore) GetExpenses(user_id int64, limit int, offset
 	expenses := []Expense{}
 	for rows.Next() {
 		expense := Expense{}
-		err := rows.Scan(&expense.ID, &expense.UserID, &expense.Amount, &expense.CategoryID, &expense.Note, &expense.Date, &expense.CreatedAt, &expense.UpdatedAt)
+		err := rows.Scan(&expense.ID, &expense.UserID, &expense.Amount, &expense.Currency, &expense.AccountID, &expense.CategoryID, &expense.PayeeID, &expense.Payee, &expense.Note, &expense.Tags, &expense.Splits, &expense.Date, &expense.RecurringRuleID, &expense.ExternalID, &expense.CreatedAt, &expense.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -273,7 +357,8 @@ func (pg *PostgresTransactionStore) GetExpenses(user_id int64, limit int, offset
 func (pg *PostgresTransactionStore) GetIncomes(user_id int64, limit int, offset int) ([]Income, error) {
 
 	query := `
-    SELECT * FROM incomes
+    SELECT id, user_id, amount, currency, account_id, category_id, payee_id, ` + payeeColumn("incomes") + `, source, note, ` + tagsColumn("income_tags", "income_id", "incomes") + `, date, recurring_rule_id, external_id, created_at, updated_at
+    FROM incomes
 	WHERE user_id = $1
     ORDER BY date DESC LIMIT $2 OFFSET $3
     `
@@ -286,7 +371,7 @@ func (pg *PostgresTransactionStore) GetIncomes(user_id int64, limit int, offset
 	incomes := []Income{}
 	for rows.Next() {
 		income := Income{}
-		err := rows.Scan(&income.ID, &income.UserID, &income.Amount, &income.CategoryID, &income.Source, &income.Note, &income.Date, &income.CreatedAt, &income.UpdatedAt)
+		err := rows.Scan(&income.ID, &income.UserID, &income.Amount, &income.Currency, &income.AccountID, &income.CategoryID, &income.PayerID, &income.Payer, &income.Source, &income.Note, &income.Tags, &income.Date, &income.RecurringRuleID, &income.ExternalID, &income.CreatedAt, &income.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -295,21 +380,71 @@ func (pg *PostgresTransactionStore) GetIncomes(user_id int64, limit int, offset
 	return incomes, nil
 }
 
-func (pg *PostgresTransactionStore) GetTransactions(user_id int64, limit int, offset int, from *time.Time, to *time.Time, month *int, year *int, _type *string, categoryID *int64) ([]Transaction, error) {
-	query := `
-	SELECT id, user_id, amount, category_id, note, NULL AS source, 'expense' AS type, date, created_at, updated_at
+// TransactionFilter narrows GetTransactions and StreamTransactions. Nil
+// fields do not filter.
+type TransactionFilter struct {
+	From  *time.Time
+	To    *time.Time
+	Month *int
+	Year  *int
+	Type  *string // expense, income or transfer
+	// also matches the category's descendants; split expenses match by
+	// their splits and are listed with the matching part of the amount
+	CategoryID *int64
+	// transactions carrying any of Tags, or all of them with AllTags
+	Tags    []string
+	AllTags bool
+}
+
+// tagFilter keeps the rows of expenses or incomes matching the tags in $11
+// and $12. joinTable and column are always our own names.
+func tagFilter(joinTable string, column string, row string) string {
+	return `AND (COALESCE(cardinality($11::text[]), 0) = 0 OR (
+		SELECT COUNT(*)
+		FROM ` + joinTable + ` jt
+		JOIN tags t ON t.id = jt.tag_id
+		WHERE jt.` + column + ` = ` + row + `.id AND t.name = ANY($11)
+	) >= CASE WHEN $12::boolean THEN cardinality($11::text[]) ELSE 1 END)`
+}
+
+// transactionsQuery lists expenses, incomes and transfers as one stream. The
+// %s is the sort direction, a NULL limit ($1) returns every row.
+var transactionsQuery = `
+	SELECT expenses.id, user_id, attributed.amount, currency, account_id, category_id, note, NULL AS source, 'expense' AS type, NULL::bigint AS to_account_id, date, created_at, updated_at,
+	CASE WHEN $10::text IS NULL THEN NULL ELSE convert_amount(attributed.amount, currency, $10, date) END AS base_amount,
+	` + tagsColumn("expense_tags", "expense_id", "expenses") + ` AS tags,
+	` + payeeColumn("expenses") + ` AS payee,
+	recurring_rule_id
 	FROM expenses
+	-- with a category filter a split expense only counts its matching
+	-- splits; NULL means the expense does not match at all
+	CROSS JOIN LATERAL (
+		SELECT CASE
+			WHEN $8::bigint IS NULL THEN expenses.amount
+			WHEN NOT EXISTS (SELECT 1 FROM expense_splits s WHERE s.expense_id = expenses.id) THEN
+				CASE WHEN expenses.category_id IN (SELECT id FROM category_subtree($8)) THEN expenses.amount END
+			ELSE (
+				SELECT SUM(s.amount) FROM expense_splits s
+				WHERE s.expense_id = expenses.id AND s.category_id IN (SELECT id FROM category_subtree($8))
+			)
+		END AS amount
+	) attributed
 	WHERE user_id = $9
 	AND	($3::timestamp IS NULL OR date >= $3)
 	AND ($4::timestamp IS NULL OR date <= $4)
 	AND ($5::int IS NULL OR EXTRACT(MONTH FROM date) = $5)
 	AND ($6::int IS NULL OR EXTRACT(YEAR FROM date) = $6)
 	AND ($7::text IS NULL OR $7 = 'expense')
-	AND ($8::int IS NULL OR $8 = category_id)
+	AND attributed.amount IS NOT NULL
+	` + tagFilter("expense_tags", "expense_id", "expenses") + `
 
 	UNION ALL
 
-	SELECT id, user_id, amount, category_id, note, source, 'income' AS type, date, created_at, updated_at
+	SELECT id, user_id, amount, currency, account_id, category_id, note, source, 'income' AS type, NULL::bigint AS to_account_id, date, created_at, updated_at,
+	CASE WHEN $10::text IS NULL THEN NULL ELSE convert_amount(amount, currency, $10, date) END AS base_amount,
+	` + tagsColumn("income_tags", "income_id", "incomes") + `,
+	` + payeeColumn("incomes") + `,
+	recurring_rule_id
 	FROM incomes
 	WHERE user_id = $9
 	AND ($3::timestamp IS NULL OR date >= $3)
@@ -317,36 +452,367 @@ func (pg *PostgresTransactionStore) GetTransactions(user_id int64, limit int, of
 	AND ($5::int IS NULL OR EXTRACT(MONTH FROM date) = $5)
 	AND ($6::int IS NULL OR EXTRACT(YEAR FROM date) = $6)
 	AND ($7::text IS NULL OR $7 = 'income')
-    AND ($8::int IS NULL OR $8 = category_id)
+	AND ($8::bigint IS NULL OR category_id IN (SELECT id FROM category_subtree($8)))
+	` + tagFilter("income_tags", "income_id", "incomes") + `
 
-	ORDER BY date DESC
+	UNION ALL
+
+	-- transfers have no category or tags, so filtering by them leaves them out
+	SELECT id, user_id, amount, currency, from_account_id, NULL::bigint, COALESCE(note, ''), NULL, 'transfer' AS type, to_account_id, date, created_at, updated_at,
+	CASE WHEN $10::text IS NULL THEN NULL ELSE convert_amount(amount, currency, $10, date) END AS base_amount,
+	'[]'::json, NULL, NULL::bigint
+	FROM transfers
+	WHERE user_id = $9
+	AND ($3::timestamp IS NULL OR date >= $3)
+	AND ($4::timestamp IS NULL OR date <= $4)
+	AND ($5::int IS NULL OR EXTRACT(MONTH FROM date) = $5)
+	AND ($6::int IS NULL OR EXTRACT(YEAR FROM date) = $6)
+	AND ($7::text IS NULL OR $7 = 'transfer')
+	AND $8::bigint IS NULL
+	AND COALESCE(cardinality($11::text[]), 0) = 0
+
+	ORDER BY date %s, id %s
 	LIMIT $1 OFFSET $2
 	`
-	rows, err := pg.db.Query(query, limit, offset, from, to, month, year, _type, categoryID, user_id)
+
+func (pg *PostgresTransactionStore) queryTransactions(user_id int64, limit *int, offset int, filter TransactionFilter, baseCurrency *string, direction string) (*sql.Rows, error) {
+	query := fmt.Sprintf(transactionsQuery, direction, direction)
+	rows, err := pg.db.Query(query, limit, offset, filter.From, filter.To, filter.Month, filter.Year, filter.Type, filter.CategoryID, user_id, baseCurrency, filter.Tags, filter.AllTags)
 	if err != nil {
 		return nil, fmt.Errorf("unable to query transactions: %v", err)
 	}
+	return rows, nil
+}
+
+func scanTransaction(row rowScanner, transaction *Transaction, baseCurrency *string) error {
+	err := row.Scan(&transaction.ID, &transaction.UserID, &transaction.Amount, &transaction.Currency, &transaction.AccountID, &transaction.CategoryID, &transaction.Note, &transaction.Source, &transaction.Type, &transaction.ToAccountID, &transaction.Date, &transaction.CreatedAt, &transaction.UpdatedAt, &transaction.BaseAmount, &transaction.Tags, &transaction.Payee, &transaction.RecurringRuleID)
+	if err != nil {
+		return err
+	}
+	if baseCurrency != nil {
+		transaction.BaseCurrency = baseCurrency
+		transaction.RateMissing = transaction.BaseAmount == nil
+	}
+	return nil
+}
+
+func (pg *PostgresTransactionStore) GetTransactions(user_id int64, limit int, offset int, filter TransactionFilter, baseCurrency *string) ([]Transaction, error) {
+	rows, err := pg.queryTransactions(user_id, &limit, offset, filter, baseCurrency, "DESC")
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
 	transactions := []Transaction{}
 	for rows.Next() {
 		transaction := Transaction{}
-		err := rows.Scan(&transaction.ID, &transaction.UserID, &transaction.Amount, &transaction.CategoryID, &transaction.Note, &transaction.Source, &transaction.Type, &transaction.Date, &transaction.CreatedAt, &transaction.UpdatedAt)
+		err := scanTransaction(rows, &transaction, baseCurrency)
 		if err != nil {
 			return nil, err
 		}
 		transactions = append(transactions, transaction)
 	}
-	return transactions, nil
+	return transactions, rows.Err()
 }
 
-// FIX: sum on 0 entries
-func (pg *PostgresTransactionStore) GetTotalExpenses(user_id int64) (float64, error) {
+// StreamTransactions calls fn for every matching transaction, oldest first,
+// while reading from the cursor, so exports never hold the whole history
+// in memory. An error from fn stops the stream and is returned.
+func (pg *PostgresTransactionStore) StreamTransactions(user_id int64, filter TransactionFilter, fn func(transaction *Transaction) error) error {
+	rows, err := pg.queryTransactions(user_id, nil, 0, filter, nil, "ASC")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		transaction := Transaction{}
+		err := scanTransaction(rows, &transaction, nil)
+		if err != nil {
+			return err
+		}
+		err = fn(&transaction)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// duplicateCandidatesQuery finds the rows of expenses or incomes with
+// another row of the same amount and currency at most $2 days away. Rows
+// posted by the same recurring rule do not count. table is always our own
+// name.
+func duplicateCandidatesQuery(table string, _type string, joinTable string, column string) string {
+	source := "NULL"
+	if table == "incomes" {
+		source = "t.source"
+	}
+	return `
+	SELECT t.id, t.user_id, t.amount, t.currency, t.account_id, t.category_id, t.note, ` + source + `, '` + _type + `', NULL::bigint, t.date, t.created_at, t.updated_at,
+	NULL::numeric, ` + tagsColumn(joinTable, column, "t") + `, ` + payeeColumn("t") + `, t.recurring_rule_id
+	FROM ` + table + ` t
+	WHERE t.user_id = $1
+	AND EXISTS (
+		SELECT 1 FROM ` + table + ` o
+		WHERE o.user_id = t.user_id AND o.id <> t.id
+		AND o.amount = t.amount AND o.currency = t.currency
+		AND o.date BETWEEN t.date - make_interval(days => $2) AND t.date + make_interval(days => $2)
+		AND (o.recurring_rule_id IS NULL OR o.recurring_rule_id IS DISTINCT FROM t.recurring_rule_id)
+	)`
+}
+
+// GetDuplicateCandidates returns the user's expenses and incomes that share
+// amount and currency with another one at most days apart, ordered so that
+// such rows are next to each other. Whether they really are duplicates is
+// left to the caller.
+func (pg *PostgresTransactionStore) GetDuplicateCandidates(user_id int64, days int) ([]Transaction, error) {
+	query := duplicateCandidatesQuery("expenses", "expense", "expense_tags", "expense_id") + `
+	UNION ALL
+	` + duplicateCandidatesQuery("incomes", "income", "income_tags", "income_id") + `
+	ORDER BY 9, 3, 4, 11, 1
+	`
+	return pg.queryTransactionList(query, user_id, days)
+}
+
+// GetExpensesNear returns the user's expenses of exactly this amount and
+// currency at most days away from date.
+func (pg *PostgresTransactionStore) GetExpensesNear(user_id int64, amount Money, currency string, date time.Time, days int) ([]Transaction, error) {
+	query := `
+	SELECT id, user_id, amount, currency, account_id, category_id, note, NULL, 'expense', NULL::bigint, date, created_at, updated_at,
+	NULL::numeric, ` + tagsColumn("expense_tags", "expense_id", "expenses") + `, ` + payeeColumn("expenses") + `, recurring_rule_id
+	FROM expenses
+	WHERE user_id = $1 AND amount = $2 AND currency = $3
+	AND date BETWEEN $4::timestamptz - make_interval(days => $5) AND $4::timestamptz + make_interval(days => $5)
+	ORDER BY date, id
+	`
+	return pg.queryTransactionList(query, user_id, amount, currency, date, days)
+}
+
+func (pg *PostgresTransactionStore) queryTransactionList(query string, args ...any) ([]Transaction, error) {
+	rows, err := pg.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []Transaction{}
+	for rows.Next() {
+		transaction := Transaction{}
+		err := scanTransaction(rows, &transaction, nil)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+	return transactions, rows.Err()
+}
+
+// StreamExpenses calls fn for each of the user's expenses, oldest first.
+// Only the amount, currency, category, payee, note and date are filled in;
+// tags and splits are left out.
+func (pg *PostgresTransactionStore) StreamExpenses(user_id int64, fn func(expense *Expense) error) error {
 	query := `
-    SELECT SUM(amount) FROM expenses
+	SELECT id, user_id, amount, currency, category_id, ` + payeeColumn("expenses") + `, note, date
+	FROM expenses
+	WHERE user_id = $1
+	ORDER BY date, id
+	`
+	rows, err := pg.db.Query(query, user_id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		expense := Expense{}
+		err := rows.Scan(&expense.ID, &expense.UserID, &expense.Amount, &expense.Currency, &expense.CategoryID, &expense.Payee, &expense.Note, &expense.Date)
+		if err != nil {
+			return err
+		}
+		err = fn(&expense)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// importResolver finds or creates the categories and payees of imported
+// rows within the import's transaction, looking each name up once.
+type importResolver struct {
+	tx         *sql.Tx
+	categories map[string]*Category
+	payees     map[string]*Payee
+}
+
+// category resolves the path of a row of _type, "uncategorized" when it has
+// none. Given paths are created with the row's kind, and a category of the
+// other kind gives a *CategoryKindError.
+func (r *importResolver) category(user_id int64, path *string, _type string) (*Category, error) {
+	category := &Category{UserID: user_id, Name: "uncategorized"}
+	if path != nil && *path != "" {
+		category.Name = strings.ToLower(*path)
+		category.Kind = _type
+	}
+	key := category.Kind + ":" + category.Name
+	if cached, ok := r.categories[key]; ok {
+		return cached, nil
+	}
+
+	category, err := findOrCreateCategory(r.tx, category)
+	if err != nil {
+		return nil, err
+	}
+	if !category.Allows(_type) {
+		return nil, &CategoryKindError{Category: category}
+	}
+	r.categories[key] = category
+	return category, nil
+}
+
+// payee resolves a payee name, ignoring case. A missing or blank name means
+// no payee.
+func (r *importResolver) payee(user_id int64, name *string) (*int64, *string, error) {
+	if name == nil || strings.TrimSpace(*name) == "" {
+		return nil, nil, nil
+	}
+	key := strings.ToLower(strings.TrimSpace(*name))
+	payee, ok := r.payees[key]
+	if !ok {
+		var err error
+		payee, err = findOrCreatePayee(r.tx, &Payee{UserID: user_id, Name: *name})
+		if err != nil {
+			return nil, nil, err
+		}
+		r.payees[key] = payee
+	}
+	return &payee.ID, &payee.Name, nil
+}
+
+// ImportTransactions books a whole statement in one transaction, so a
+// failing row leaves nothing half imported. Categories are taken from
+// Category and payees from Payee or Payer, by name, and missing ones are
+// created in the same transaction, so they go too when the import fails.
+// Rows whose external id was imported before are skipped and keep a zero
+// ID; the number of skipped rows is returned.
+func (pg *PostgresTransactionStore) ImportTransactions(expenses []*Expense, incomes []*Income) (int, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	resolver := &importResolver{tx: tx, categories: map[string]*Category{}, payees: map[string]*Payee{}}
+	for _, expense := range expenses {
+		category, err := resolver.category(expense.UserID, expense.Category, "expense")
+		if err != nil {
+			return 0, err
+		}
+		expense.CategoryID, expense.Category = category.ID, &category.Path
+		expense.PayeeID, expense.Payee, err = resolver.payee(expense.UserID, expense.Payee)
+		if err != nil {
+			return 0, err
+		}
+	}
+	for _, income := range incomes {
+		category, err := resolver.category(income.UserID, income.Category, "income")
+		if err != nil {
+			return 0, err
+		}
+		income.CategoryID, income.Category = category.ID, &category.Path
+		income.PayerID, income.Payer, err = resolver.payee(income.UserID, income.Payer)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	skipped := 0
+	query := `
+	INSERT INTO expenses (user_id, amount, currency, account_id, category_id, payee_id, note, date, external_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	ON CONFLICT (user_id, external_id) WHERE external_id IS NOT NULL DO NOTHING
+	RETURNING id, created_at, updated_at
+	`
+	for _, expense := range expenses {
+		err := tx.QueryRow(query, expense.UserID, expense.Amount, expense.Currency, expense.AccountID, expense.CategoryID, expense.PayeeID, expense.Note, expense.Date, expense.ExternalID).Scan(&expense.ID, &expense.CreatedAt, &expense.UpdatedAt)
+		if err == sql.ErrNoRows {
+			skipped++
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		err = setTags(tx, "expense_tags", "expense_id", expense.ID, expense.UserID, expense.Tags)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	query = `
+	INSERT INTO incomes (user_id, amount, currency, account_id, category_id, payee_id, source, note, date, external_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	ON CONFLICT (user_id, external_id) WHERE external_id IS NOT NULL DO NOTHING
+	RETURNING id, created_at, updated_at
+	`
+	for _, income := range incomes {
+		err := tx.QueryRow(query, income.UserID, income.Amount, income.Currency, income.AccountID, income.CategoryID, income.PayerID, income.Source, income.Note, income.Date, income.ExternalID).Scan(&income.ID, &income.CreatedAt, &income.UpdatedAt)
+		if err == sql.ErrNoRows {
+			skipped++
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		err = setTags(tx, "income_tags", "income_id", income.ID, income.UserID, income.Tags)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return skipped, nil
+}
+
+// GetImportedExternalIDs returns which of the given external ids the user
+// has already imported, as expense or income.
+func (pg *PostgresTransactionStore) GetImportedExternalIDs(user_id int64, externalIDs []string) (map[string]bool, error) {
+	imported := map[string]bool{}
+	if len(externalIDs) == 0 {
+		return imported, nil
+	}
+
+	query := `
+	SELECT external_id FROM expenses WHERE user_id = $1 AND external_id = ANY($2)
+	UNION
+	SELECT external_id FROM incomes WHERE user_id = $1 AND external_id = ANY($2)
+	`
+	rows, err := pg.db.Query(query, user_id, externalIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var externalID string
+		err := rows.Scan(&externalID)
+		if err != nil {
+			return nil, err
+		}
+		imported[externalID] = true
+	}
+	return imported, rows.Err()
+}
+
+func (pg *PostgresTransactionStore) GetTotalExpenses(user_id int64) (Money, error) {
+	query := `
+    SELECT COALESCE(SUM(amount), 0) FROM expenses
     WHERE user_id = $1
     `
-	var total float64
+	var total Money
 	err := pg.db.QueryRow(query, user_id).Scan(&total)
 	if err != nil {
 		return 0, err
@@ -354,16 +820,58 @@ func (pg *PostgresTransactionStore) GetTotalExpenses(user_id int64) (float64, er
 	return total, nil
 }
 
-// FIX: sum on 0 entries
-func (pg *PostgresTransactionStore) GetTotalIncomes(user_id int64) (float64, error) {
+func (pg *PostgresTransactionStore) GetTotalExpensesConverted(user_id int64, baseCurrency string) (*ConvertedTotal, error) {
+	return pg.getConvertedTotal("expenses", user_id, baseCurrency)
+}
+
+func (pg *PostgresTransactionStore) GetTotalIncomes(user_id int64) (Money, error) {
 	query := `
-    SELECT SUM(amount) FROM incomes
+    SELECT COALESCE(SUM(amount), 0) FROM incomes
 	WHERE user_id = $1
     `
-	var total float64
+	var total Money
 	err := pg.db.QueryRow(query, user_id).Scan(&total)
 	if err != nil {
 		return 0, err
 	}
 	return total, nil
 }
+
+func (pg *PostgresTransactionStore) GetTotalIncomesConverted(user_id int64, baseCurrency string) (*ConvertedTotal, error) {
+	return pg.getConvertedTotal("incomes", user_id, baseCurrency)
+}
+
+// getConvertedTotal sums table per original currency and in baseCurrency.
+// table is always one of our own table names, never user input.
+func (pg *PostgresTransactionStore) getConvertedTotal(table string, user_id int64, baseCurrency string) (*ConvertedTotal, error) {
+	query := `
+	SELECT currency, SUM(amount), COALESCE(SUM(base_amount), 0), COUNT(*) - COUNT(base_amount)
+	FROM (
+		SELECT currency, amount, convert_amount(amount, currency, $2, date) AS base_amount
+		FROM ` + table + `
+		WHERE user_id = $1
+	) t
+	GROUP BY currency
+	ORDER BY currency
+	`
+	rows, err := pg.db.Query(query, user_id, baseCurrency)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	converted := &ConvertedTotal{Currency: baseCurrency, ByCurrency: []CurrencyTotal{}}
+	for rows.Next() {
+		var currencyTotal CurrencyTotal
+		var baseTotal Money
+		var missing int
+		err := rows.Scan(&currencyTotal.Currency, &currencyTotal.Total, &baseTotal, &missing)
+		if err != nil {
+			return nil, err
+		}
+		converted.Total += baseTotal
+		converted.MissingRates += missing
+		converted.ByCurrency = append(converted.ByCurrency, currencyTotal)
+	}
+	return converted, rows.Err()
+}
@@ -0,0 +1,207 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrTransferAccount  = errors.New("both accounts must exist, belong to you and be different")
+	ErrTransferCurrency = errors.New("both accounts must use the same currency")
+)
+
+// Transfer moves money between two accounts of the same user. It changes
+// both balances but is never counted as income or expense.
+type Transfer struct {
+	ID            int64      `json:"id"`
+	UserID        int64      `json:"user_id"`
+	FromAccountID int64      `json:"from_account_id"`
+	ToAccountID   int64      `json:"to_account_id"`
+	Amount        Money      `json:"amount"`
+	Currency      string     `json:"currency"`
+	Note          string     `json:"note"`
+	Date          *time.Time `json:"date"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+type PostgresTransferStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTransferStore(db *sql.DB) *PostgresTransferStore {
+	return &PostgresTransferStore{
+		db: db,
+	}
+}
+
+type TransferStore interface {
+	CreateTransfer(transfer *Transfer) (*Transfer, error)
+	GetTransferByID(id int64) (*Transfer, error)
+	GetTransfers(user_id int64, limit int, offset int) ([]Transfer, error)
+	UpdateTransfer(transfer *Transfer) error
+	DeleteTransferByID(id int64) error
+}
+
+// lockTransferAccounts locks both accounts for the rest of tx, checks that
+// they belong to the transfer's user and returns their shared currency.
+func lockTransferAccounts(tx *sql.Tx, transfer *Transfer) (string, error) {
+	if transfer.FromAccountID == transfer.ToAccountID {
+		return "", ErrTransferAccount
+	}
+
+	query := `
+	SELECT id, currency FROM accounts
+	WHERE id IN ($1, $2) AND user_id = $3
+	ORDER BY id
+	FOR UPDATE
+	`
+	rows, err := tx.Query(query, transfer.FromAccountID, transfer.ToAccountID, transfer.UserID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	currencies := []string{}
+	for rows.Next() {
+		var id int64
+		var currency string
+		err := rows.Scan(&id, &currency)
+		if err != nil {
+			return "", err
+		}
+		currencies = append(currencies, currency)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	if len(currencies) != 2 {
+		return "", ErrTransferAccount
+	}
+	if currencies[0] != currencies[1] {
+		return "", ErrTransferCurrency
+	}
+	return currencies[0], nil
+}
+
+func (pg *PostgresTransferStore) CreateTransfer(transfer *Transfer) (*Transfer, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	transfer.Currency, err = lockTransferAccounts(tx, transfer)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	INSERT INTO transfers (user_id, from_account_id, to_account_id, amount, currency, note, date)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id, created_at, updated_at
+	`
+	err = tx.QueryRow(query, transfer.UserID, transfer.FromAccountID, transfer.ToAccountID, transfer.Amount, transfer.Currency, transfer.Note, transfer.Date).Scan(&transfer.ID, &transfer.CreatedAt, &transfer.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+func (pg *PostgresTransferStore) GetTransferByID(id int64) (*Transfer, error) {
+	transfer := &Transfer{}
+	query := `
+	SELECT id, user_id, from_account_id, to_account_id, amount, currency, COALESCE(note, ''), date, created_at, updated_at
+	FROM transfers
+	WHERE id = $1
+	`
+	err := pg.db.QueryRow(query, id).Scan(&transfer.ID, &transfer.UserID, &transfer.FromAccountID, &transfer.ToAccountID, &transfer.Amount, &transfer.Currency, &transfer.Note, &transfer.Date, &transfer.CreatedAt, &transfer.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+func (pg *PostgresTransferStore) GetTransfers(user_id int64, limit int, offset int) ([]Transfer, error) {
+	query := `
+	SELECT id, user_id, from_account_id, to_account_id, amount, currency, COALESCE(note, ''), date, created_at, updated_at
+	FROM transfers
+	WHERE user_id = $1
+	ORDER BY date DESC LIMIT $2 OFFSET $3
+	`
+	rows, err := pg.db.Query(query, user_id, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := []Transfer{}
+	for rows.Next() {
+		transfer := Transfer{}
+		err := rows.Scan(&transfer.ID, &transfer.UserID, &transfer.FromAccountID, &transfer.ToAccountID, &transfer.Amount, &transfer.Currency, &transfer.Note, &transfer.Date, &transfer.CreatedAt, &transfer.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, rows.Err()
+}
+
+func (pg *PostgresTransferStore) UpdateTransfer(transfer *Transfer) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	transfer.Currency, err = lockTransferAccounts(tx, transfer)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE transfers
+	SET from_account_id = $1, to_account_id = $2, amount = $3, currency = $4, note = $5, date = $6, updated_at = $7
+	WHERE id = $8
+	`
+	result, err := tx.Exec(query, transfer.FromAccountID, transfer.ToAccountID, transfer.Amount, transfer.Currency, transfer.Note, transfer.Date, transfer.UpdatedAt, transfer.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+func (pg *PostgresTransferStore) DeleteTransferByID(id int64) error {
+	query := `
+	DELETE FROM transfers
+	WHERE id = $1
+	`
+	result, err := pg.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// MaxLoginChallengeAttempts is how many codes may be tried for one login
+// before the password has to be entered again.
+const MaxLoginChallengeAttempts = 5
+
+// TOTP is a user's authenticator secret. It only guards logins once it is
+// enabled, which happens when the user confirms it with a first code.
+type TOTP struct {
+	UserID    int64
+	Secret    string
+	EnabledAt *time.Time
+	LastStep  int64 // period of the last code accepted
+}
+
+func (t *TOTP) Enabled() bool {
+	return t.EnabledAt != nil
+}
+
+type PostgresTwoFactorStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTwoFactorStore(db *sql.DB) *PostgresTwoFactorStore {
+	return &PostgresTwoFactorStore{
+		db: db,
+	}
+}
+
+type TwoFactorStore interface {
+	GetTOTP(user_id int64) (*TOTP, error)
+	SetPendingTOTP(user_id int64, secret string) error
+	EnableTOTP(user_id int64, step int64, codeHashes [][]byte) error
+	UseTOTPStep(user_id int64, step int64) (bool, error)
+	DisableTOTP(user_id int64) error
+
+	ReplaceRecoveryCodes(user_id int64, codeHashes [][]byte) error
+	UseRecoveryCode(user_id int64, codeHash []byte) (bool, error)
+	CountRecoveryCodes(user_id int64) (int, error)
+
+	CreateLoginChallenge(user_id int64, tokenHash []byte, expiresAt time.Time) error
+	AttemptLoginChallenge(tokenHash []byte) (int64, error)
+	DeleteLoginChallenge(tokenHash []byte) error
+}
+
+func (pg *PostgresTwoFactorStore) GetTOTP(user_id int64) (*TOTP, error) {
+	totp := &TOTP{}
+	query := `
+	SELECT user_id, secret, enabled_at, last_step
+	FROM user_totp
+	WHERE user_id = $1
+	`
+	err := pg.db.QueryRow(query, user_id).Scan(&totp.UserID, &totp.Secret, &totp.EnabledAt, &totp.LastStep)
+	if err != nil {
+		return nil, err
+	}
+	return totp, nil
+}
+
+// SetPendingTOTP stores a new secret that is not enabled yet, replacing an
+// earlier one that was never confirmed. An enabled secret is left alone and
+// gives sql.ErrNoRows.
+func (pg *PostgresTwoFactorStore) SetPendingTOTP(user_id int64, secret string) error {
+	query := `
+	INSERT INTO user_totp (user_id, secret)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE
+	SET secret = EXCLUDED.secret, last_step = 0, updated_at = CURRENT_TIMESTAMP
+	WHERE user_totp.enabled_at IS NULL
+	`
+	result, err := pg.db.Exec(query, user_id, secret)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// EnableTOTP turns on the pending secret, recording the step of the code it
+// was confirmed with, and gives the user their first recovery codes.
+func (pg *PostgresTwoFactorStore) EnableTOTP(user_id int64, step int64, codeHashes [][]byte) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE user_totp
+	SET enabled_at = CURRENT_TIMESTAMP, last_step = $2, updated_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND enabled_at IS NULL
+	`
+	result, err := tx.Exec(query, user_id, step)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	err = replaceRecoveryCodes(tx, user_id, codeHashes)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep records that a code of step was accepted. It reports false
+// when that step or a later one was used already, so each code works once.
+func (pg *PostgresTwoFactorStore) UseTOTPStep(user_id int64, step int64) (bool, error) {
+	query := `
+	UPDATE user_totp SET last_step = $2, updated_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND last_step < $2
+	`
+	result, err := pg.db.Exec(query, user_id, step)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// DisableTOTP removes the secret along with the recovery codes and any
+// logins waiting for a code.
+func (pg *PostgresTwoFactorStore) DisableTOTP(user_id int64) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM user_totp WHERE user_id = $1`,
+		`DELETE FROM recovery_codes WHERE user_id = $1`,
+		`DELETE FROM login_challenges WHERE user_id = $1`,
+	} {
+		_, err = tx.Exec(query, user_id)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, user_id int64, codeHashes [][]byte) error {
+	_, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, user_id)
+	if err != nil {
+		return err
+	}
+	for _, codeHash := range codeHashes {
+		_, err = tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, user_id, codeHash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes throws away the user's recovery codes, used or not,
+// for new ones.
+func (pg *PostgresTwoFactorStore) ReplaceRecoveryCodes(user_id int64, codeHashes [][]byte) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = replaceRecoveryCodes(tx, user_id, codeHashes)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode uses up one of the user's recovery codes, reporting false
+// when it is not theirs or was used before.
+func (pg *PostgresTwoFactorStore) UseRecoveryCode(user_id int64, codeHash []byte) (bool, error) {
+	query := `
+	UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+	result, err := pg.db.Exec(query, user_id, codeHash)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// CountRecoveryCodes counts the recovery codes the user has left.
+func (pg *PostgresTwoFactorStore) CountRecoveryCodes(user_id int64) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+	err := pg.db.QueryRow(query, user_id).Scan(&count)
+	return count, err
+}
+
+// CreateLoginChallenge stores the hash of the token a login continues with
+// once the password was right. Expired challenges of the user are cleaned
+// up on the way.
+func (pg *PostgresTwoFactorStore) CreateLoginChallenge(user_id int64, tokenHash []byte, expiresAt time.Time) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM login_challenges WHERE user_id = $1 AND expires_at < CURRENT_TIMESTAMP`, user_id)
+	if err != nil {
+		return err
+	}
+	query := `
+	INSERT INTO login_challenges (user_id, token_hash, expires_at)
+	VALUES ($1, $2, $3)
+	`
+	_, err = tx.Exec(query, user_id, tokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AttemptLoginChallenge counts an attempt at a code for the challenge and
+// returns whose login it is. Unknown and expired challenges, and those out
+// of attempts, give sql.ErrNoRows.
+func (pg *PostgresTwoFactorStore) AttemptLoginChallenge(tokenHash []byte) (int64, error) {
+	var user_id int64
+	query := `
+	UPDATE login_challenges SET attempts = attempts + 1
+	WHERE token_hash = $1 AND expires_at > CURRENT_TIMESTAMP AND attempts < $2
+	RETURNING user_id
+	`
+	err := pg.db.QueryRow(query, tokenHash, MaxLoginChallengeAttempts).Scan(&user_id)
+	return user_id, err
+}
+
+// DeleteLoginChallenge ends a challenge once the login is complete.
+func (pg *PostgresTwoFactorStore) DeleteLoginChallenge(tokenHash []byte) error {
+	_, err := pg.db.Exec(`DELETE FROM login_challenges WHERE token_hash = $1`, tokenHash)
+	return err
+}
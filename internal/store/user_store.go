@@ -37,12 +37,14 @@ func (p *password) Matches(plainTextPassword string) (bool, error) {
 }
 
 type User struct {
-	ID           int64     `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash password  `json:"password"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID            int64     `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	PasswordHash  password  `json:"-"`
+	BaseCurrency  string    `json:"base_currency"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 type PostgresUserStore struct {
@@ -57,14 +59,43 @@ func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
 
 type UserStore interface {
 	GetUserByUsername(username string) (*User, error)
+	GetUserByEmail(email string) (*User, error)
 	CreateUser(user *User) (*User, error)
 	GetUserByID(id int64) (*User, error)
+	UpdateBaseCurrency(user_id int64, currency string) error
+
+	CreateUserToken(user_id int64, purpose string, tokenHash []byte, expiresAt time.Time) error
+	VerifyEmail(tokenHash []byte) (int64, error)
+	ResetPassword(tokenHash []byte, user *User) error
+}
+
+// Purposes of the single-use tokens mailed to users.
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+)
+
+const userColumns = `id, username, email, email_verified, password_hash, base_currency, created_at, updated_at`
+
+func scanUser(row rowScanner, user *User) error {
+	return row.Scan(&user.ID, &user.Username, &user.Email, &user.EmailVerified, &user.PasswordHash.hash, &user.BaseCurrency, &user.CreatedAt, &user.UpdatedAt)
 }
 
 func (p *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
-	query := `SELECT id, username, email, password_hash, created_at, updated_at FROM users WHERE username = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1`
+	var user User
+	err := scanUser(p.db.QueryRow(query, username), &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserByEmail ignores the case of the address.
+func (p *PostgresUserStore) GetUserByEmail(email string) (*User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE lower(email) = lower($1)`
 	var user User
-	err := p.db.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash.hash, &user.CreatedAt, &user.UpdatedAt)
+	err := scanUser(p.db.QueryRow(query, email), &user)
 	if err != nil {
 		return nil, err
 	}
@@ -72,8 +103,8 @@ func (p *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
 }
 
 func (p *PostgresUserStore) CreateUser(user *User) (*User, error) {
-	query := `INSERT INTO users (username, email, password_hash) VALUES ($1, $2, $3) RETURNING id, created_at`
-	err := p.db.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash).Scan(&user.ID, &user.CreatedAt)
+	query := `INSERT INTO users (username, email, password_hash, base_currency) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	err := p.db.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.BaseCurrency).Scan(&user.ID, &user.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -81,11 +112,118 @@ func (p *PostgresUserStore) CreateUser(user *User) (*User, error) {
 }
 
 func (p *PostgresUserStore) GetUserByID(id int64) (*User, error) {
-	query := `SELECT id, username, email, password_hash, created_at, updated_at FROM users WHERE id = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
 	var user User
-	err := p.db.QueryRow(query, id).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash.hash, &user.CreatedAt, &user.UpdatedAt)
+	err := scanUser(p.db.QueryRow(query, id), &user)
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
+
+func (p *PostgresUserStore) UpdateBaseCurrency(user_id int64, currency string) error {
+	query := `UPDATE users SET base_currency = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+	result, err := p.db.Exec(query, currency, user_id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CreateUserToken stores the hash of a token mailed to the user. Earlier
+// unused tokens for the same purpose stop working, so only the latest mail
+// counts.
+func (p *PostgresUserStore) CreateUserToken(user_id int64, purpose string, tokenHash []byte, expiresAt time.Time) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+	`
+	_, err = tx.Exec(query, user_id, purpose)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at)
+	VALUES ($1, $2, $3, $4)
+	`
+	_, err = tx.Exec(query, user_id, purpose, tokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// consumeUserToken uses up a token and returns whose it was. Unknown, used
+// and expired tokens give sql.ErrNoRows.
+func consumeUserToken(tx *sql.Tx, purpose string, tokenHash []byte) (int64, error) {
+	var user_id int64
+	query := `
+	UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP
+	WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+	RETURNING user_id
+	`
+	err := tx.QueryRow(query, tokenHash, purpose).Scan(&user_id)
+	return user_id, err
+}
+
+// VerifyEmail marks the email of the token's user as verified and returns
+// the user's id.
+func (p *PostgresUserStore) VerifyEmail(tokenHash []byte) (int64, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	user_id, err := consumeUserToken(tx, TokenEmailVerification, tokenHash)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`UPDATE users SET email_verified = TRUE, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, user_id)
+	if err != nil {
+		return 0, err
+	}
+	return user_id, tx.Commit()
+}
+
+// ResetPassword sets the password of the token's user to the one hashed in
+// user and logs them out everywhere. user.ID is filled in.
+func (p *PostgresUserStore) ResetPassword(tokenHash []byte, user *User) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	user.ID, err = consumeUserToken(tx, TokenPasswordReset, tokenHash)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE users SET password_hash = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`, user.PasswordHash.hash, user.ID)
+	if err != nil {
+		return err
+	}
+	query := `
+	UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND revoked_at IS NULL
+	`
+	_, err = tx.Exec(query, user.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,103 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890"
+// in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The RFC lists eight-digit codes; six-digit codes are their last six digits.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{unix: 59, code: "287082"},
+	{unix: 1111111109, code: "081804"},
+	{unix: 1111111111, code: "050471"},
+	{unix: 1234567890, code: "005924"},
+	{unix: 2000000000, code: "279037"},
+	{unix: 20000000000, code: "353130"},
+}
+
+func TestCode(t *testing.T) {
+	for _, tt := range rfcVectors {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d) error: %v", tt.unix, err)
+		}
+		if got != tt.code {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+
+	got, err := Code(strings.ToLower(rfcSecret), 1)
+	if err != nil || got != "287082" {
+		t.Errorf("Code with a lower-case secret = %s, %v, want 287082", got, err)
+	}
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code with an invalid secret = nil error, want error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range rfcVectors {
+		at := time.Unix(tt.unix, 0)
+		step, ok := Validate(rfcSecret, tt.code, at)
+		if !ok || step != Step(at) {
+			t.Errorf("Validate(%s) at %d = %d, %v, want %d, true", tt.code, tt.unix, step, ok, Step(at))
+		}
+	}
+
+	code, err := Code(rfcSecret, 10) // 300s to 329s
+	if err != nil {
+		t.Fatalf("Code(10) error: %v", err)
+	}
+	tests := []struct {
+		unix int64
+		ok   bool
+	}{
+		{unix: 269, ok: false}, // two periods early
+		{unix: 270, ok: true},  // one period early
+		{unix: 315, ok: true},
+		{unix: 359, ok: true},  // one period late
+		{unix: 360, ok: false}, // two periods late
+	}
+	for _, tt := range tests {
+		step, ok := Validate(rfcSecret, code, time.Unix(tt.unix, 0))
+		if ok != tt.ok {
+			t.Errorf("Validate(%s) at %d = %v, want %v", code, tt.unix, ok, tt.ok)
+		}
+		if ok && step != 10 {
+			t.Errorf("Validate(%s) at %d returned step %d, want 10", code, tt.unix, step)
+		}
+	}
+}
+
+func TestValidateRejectsMalformedCodes(t *testing.T) {
+	at := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870820", "94287082", "abcdef", "287083"} {
+		if _, ok := Validate(rfcSecret, code, at); ok {
+			t.Errorf("Validate(%q) = true, want false", code)
+		}
+	}
+	if _, ok := Validate(rfcSecret, "287 082", at); !ok {
+		t.Error(`Validate("287 082") = false, want true`)
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret() error: %v", err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("GenerateSecret() = %q, want 32 base32 characters", secret)
+	}
+	if _, err := Code(secret, 0); err != nil {
+		t.Errorf("Code with a generated secret error: %v", err)
+	}
+}
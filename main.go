@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/KartikSindura/money/internal/app"
@@ -25,9 +30,31 @@ func main() {
 		WriteTimeout: 30 * time.Second,
 	}
 
-	app.Logger.Printf("we are running on port %d", port)
-	err = server.ListenAndServe()
-	if err != nil {
-		app.Logger.Fatal(err)
+	// on SIGINT or SIGTERM, finish the requests in flight and let the
+	// recurring worker complete the rule it is posting before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		app.Logger.Printf("we are running on port %d", port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			app.Logger.Fatal(err)
+		}
+	case <-ctx.Done():
+		app.Logger.Printf("shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		err = server.Shutdown(shutdownCtx)
+		if err != nil {
+			app.Logger.Printf("Error: shutting down server: %v", err)
+		}
 	}
+
+	app.RecurringWorker.Stop()
 }
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS recurring_rules (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id),
+  type TEXT NOT NULL CHECK (type IN ('expense', 'income')),
+  amount FLOAT NOT NULL,
+  category_id INT REFERENCES categories(id),
+  source TEXT,
+  note TEXT,
+  frequency TEXT NOT NULL CHECK (frequency IN ('daily', 'weekly', 'monthly', 'yearly')),
+  repeat_interval INT NOT NULL DEFAULT 1 CHECK (repeat_interval > 0),
+  start_date TIMESTAMP WITH TIME ZONE NOT NULL,
+  end_date TIMESTAMP WITH TIME ZONE,
+  max_occurrences INT CHECK (max_occurrences > 0),
+  occurrences INT NOT NULL DEFAULT 0,
+  next_run TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_recurring_rules_on_next_run ON recurring_rules(next_run);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE recurring_rules;
+-- +goose StatementEnd
@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE expenses
+ADD COLUMN recurring_rule_id BIGINT REFERENCES recurring_rules(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE incomes
+ADD COLUMN recurring_rule_id BIGINT REFERENCES recurring_rules(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- one materialized row per rule and occurrence date, so the worker can retry safely
+-- +goose StatementBegin
+CREATE UNIQUE INDEX unique_expenses_recurring_occurrence ON expenses(recurring_rule_id, date);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX unique_incomes_recurring_occurrence ON incomes(recurring_rule_id, date);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX unique_incomes_recurring_occurrence;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX unique_expenses_recurring_occurrence;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE incomes
+DROP COLUMN recurring_rule_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE expenses
+DROP COLUMN recurring_rule_id;
+-- +goose StatementEnd
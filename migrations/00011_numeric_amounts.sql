@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE expenses
+ALTER COLUMN amount TYPE NUMERIC(14, 2) USING ROUND(amount::numeric, 2);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE incomes
+ALTER COLUMN amount TYPE NUMERIC(14, 2) USING ROUND(amount::numeric, 2);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE recurring_rules
+ALTER COLUMN amount TYPE NUMERIC(14, 2) USING ROUND(amount::numeric, 2);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE budgets
+ALTER COLUMN amount TYPE NUMERIC(14, 2) USING ROUND(amount::numeric, 2);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE budgets
+ALTER COLUMN amount TYPE FLOAT USING amount::float;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE recurring_rules
+ALTER COLUMN amount TYPE FLOAT USING amount::float;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE incomes
+ALTER COLUMN amount TYPE FLOAT USING amount::float;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE expenses
+ALTER COLUMN amount TYPE FLOAT USING amount::float;
+-- +goose StatementEnd
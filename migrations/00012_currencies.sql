@@ -0,0 +1,78 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN base_currency TEXT NOT NULL DEFAULT 'INR';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE expenses
+ADD COLUMN currency TEXT NOT NULL DEFAULT 'INR';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE incomes
+ADD COLUMN currency TEXT NOT NULL DEFAULT 'INR';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE recurring_rules
+ADD COLUMN currency TEXT NOT NULL DEFAULT 'INR';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS exchange_rates (
+  from_currency TEXT NOT NULL,
+  to_currency TEXT NOT NULL,
+  effective_date DATE NOT NULL,
+  rate NUMERIC(20, 10) NOT NULL CHECK (rate > 0),
+  PRIMARY KEY (from_currency, to_currency, effective_date)
+)
+-- +goose StatementEnd
+
+-- convert_amount converts with the latest rate effective on the given date,
+-- falling back to the inverse pair. It returns NULL when no rate is known.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION convert_amount(p_amount NUMERIC, p_from TEXT, p_to TEXT, p_on TIMESTAMP WITH TIME ZONE)
+RETURNS NUMERIC AS $$
+  SELECT CASE
+    WHEN p_from = p_to THEN p_amount
+    ELSE ROUND(p_amount * COALESCE(
+      (SELECT rate FROM exchange_rates
+       WHERE from_currency = p_from AND to_currency = p_to AND effective_date <= p_on::date
+       ORDER BY effective_date DESC LIMIT 1),
+      (SELECT 1 / rate FROM exchange_rates
+       WHERE from_currency = p_to AND to_currency = p_from AND effective_date <= p_on::date
+       ORDER BY effective_date DESC LIMIT 1)
+    ), 2)
+  END
+$$ LANGUAGE SQL STABLE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP FUNCTION convert_amount(NUMERIC, TEXT, TEXT, TIMESTAMP WITH TIME ZONE);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE exchange_rates;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE recurring_rules
+DROP COLUMN currency;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE incomes
+DROP COLUMN currency;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE expenses
+DROP COLUMN currency;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE users
+DROP COLUMN base_currency;
+-- +goose StatementEnd
@@ -0,0 +1,57 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS accounts (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id),
+  name TEXT NOT NULL,
+  type TEXT NOT NULL CHECK (type IN ('cash', 'bank', 'credit', 'loan')),
+  opening_balance NUMERIC(14, 2) NOT NULL DEFAULT 0,
+  currency TEXT NOT NULL DEFAULT 'INR',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT unique_user_account UNIQUE (user_id, name)
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE expenses
+ADD COLUMN account_id BIGINT REFERENCES accounts(id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE incomes
+ADD COLUMN account_id BIGINT REFERENCES accounts(id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE recurring_rules
+ADD COLUMN account_id BIGINT REFERENCES accounts(id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_expenses_on_account_id ON expenses(account_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_incomes_on_account_id ON incomes(account_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE recurring_rules
+DROP COLUMN account_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE incomes
+DROP COLUMN account_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE expenses
+DROP COLUMN account_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE accounts;
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS transfers (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id),
+  from_account_id BIGINT NOT NULL REFERENCES accounts(id),
+  to_account_id BIGINT NOT NULL REFERENCES accounts(id),
+  amount NUMERIC(14, 2) NOT NULL CHECK (amount > 0),
+  currency TEXT NOT NULL,
+  note TEXT,
+  date TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT transfer_between_different_accounts CHECK (from_account_id <> to_account_id)
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_transfers_on_date ON transfers(date DESC);
+-- +goose StatementEnd
+
+-- account balances sum the transfers in and out of each account
+-- +goose StatementBegin
+CREATE INDEX index_transfers_on_from_account_id ON transfers(from_account_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_transfers_on_to_account_id ON transfers(to_account_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE transfers;
+-- +goose StatementEnd
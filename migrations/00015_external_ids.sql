@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE expenses ADD COLUMN external_id TEXT;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE incomes ADD COLUMN external_id TEXT;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX unique_expenses_external_id ON expenses(user_id, external_id) WHERE external_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX unique_incomes_external_id ON incomes(user_id, external_id) WHERE external_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX unique_incomes_external_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX unique_expenses_external_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE incomes DROP COLUMN external_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE expenses DROP COLUMN external_id;
+-- +goose StatementEnd
@@ -0,0 +1,74 @@
+-- +goose Up
+-- category names were unique across all users, which made the second user's
+-- "food" fail; names are now unique per user and parent
+-- +goose StatementBegin
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_name_key;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE categories DROP CONSTRAINT unique_user_category;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE categories
+ADD COLUMN parent_id BIGINT REFERENCES categories(id),
+ADD CONSTRAINT category_not_own_parent CHECK (parent_id <> id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX unique_user_category_parent_name ON categories(user_id, (COALESCE(parent_id, 0)), name);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_categories_on_parent_id ON categories(parent_id);
+-- +goose StatementEnd
+
+-- category_subtree returns the category and all of its descendants
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION category_subtree(p_id BIGINT)
+RETURNS TABLE (id BIGINT)
+LANGUAGE sql STABLE AS $$
+  WITH RECURSIVE tree AS (
+    SELECT c.id FROM categories c WHERE c.id = p_id
+    UNION ALL
+    SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+  )
+  SELECT tree.id FROM tree
+$$;
+-- +goose StatementEnd
+
+-- category_path returns the full "parent/child" name of a category
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION category_path(p_id BIGINT)
+RETURNS TEXT
+LANGUAGE sql STABLE AS $$
+  WITH RECURSIVE up AS (
+    SELECT c.parent_id, c.name::text AS path FROM categories c WHERE c.id = p_id
+    UNION ALL
+    SELECT c.parent_id, c.name || '/' || up.path FROM categories c JOIN up ON c.id = up.parent_id
+  )
+  SELECT path FROM up WHERE parent_id IS NULL
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP FUNCTION category_path(BIGINT);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP FUNCTION category_subtree(BIGINT);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX unique_user_category_parent_name;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE categories DROP COLUMN parent_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE categories
+ADD CONSTRAINT unique_user_category UNIQUE (user_id, name);
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE categories
+ADD COLUMN kind TEXT NOT NULL DEFAULT 'both' CHECK (kind IN ('expense', 'income', 'both')),
+ADD COLUMN color TEXT,
+ADD COLUMN icon TEXT;
+-- +goose StatementEnd
+
+-- categories that were only ever used on one side get that kind; the
+-- default "uncategorized" stays usable for both
+-- +goose StatementBegin
+UPDATE categories c
+SET kind = CASE WHEN EXISTS (SELECT 1 FROM incomes i WHERE i.category_id = c.id) THEN 'income' ELSE 'expense' END
+WHERE c.name <> 'uncategorized'
+AND EXISTS (SELECT 1 FROM expenses e WHERE e.category_id = c.id)
+<> EXISTS (SELECT 1 FROM incomes i WHERE i.category_id = c.id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE categories
+DROP COLUMN kind,
+DROP COLUMN color,
+DROP COLUMN icon;
+-- +goose StatementEnd
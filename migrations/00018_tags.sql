@@ -0,0 +1,47 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS tags (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id),
+  name TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT unique_user_tag UNIQUE (user_id, name)
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS expense_tags (
+  expense_id BIGINT NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+  tag_id BIGINT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+  PRIMARY KEY (expense_id, tag_id)
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS income_tags (
+  income_id BIGINT NOT NULL REFERENCES incomes(id) ON DELETE CASCADE,
+  tag_id BIGINT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+  PRIMARY KEY (income_id, tag_id)
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_expense_tags_on_tag_id ON expense_tags(tag_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_income_tags_on_tag_id ON income_tags(tag_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE income_tags;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE expense_tags;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE tags;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS expense_splits (
+  id BIGSERIAL PRIMARY KEY,
+  expense_id BIGINT NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+  category_id BIGINT NOT NULL REFERENCES categories(id),
+  amount NUMERIC(14, 2) NOT NULL CHECK (amount > 0),
+  note TEXT
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_expense_splits_on_expense_id ON expense_splits(expense_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_expense_splits_on_category_id ON expense_splits(category_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE expense_splits;
+-- +goose StatementEnd
@@ -0,0 +1,61 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS payees (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id),
+  name TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+)
+-- +goose StatementEnd
+
+-- "Amazon" and "amazon" are the same payee
+-- +goose StatementBegin
+CREATE UNIQUE INDEX unique_user_payee ON payees(user_id, lower(name));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE expenses ADD COLUMN payee_id BIGINT REFERENCES payees(id);
+-- +goose StatementEnd
+
+-- the payer of an income
+-- +goose StatementBegin
+ALTER TABLE incomes ADD COLUMN payee_id BIGINT REFERENCES payees(id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_expenses_on_payee_id ON expenses(payee_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_incomes_on_payee_id ON incomes(payee_id);
+-- +goose StatementEnd
+
+-- income sources become payers
+-- +goose StatementBegin
+INSERT INTO payees (user_id, name)
+SELECT DISTINCT ON (user_id, lower(btrim(source))) user_id, btrim(source)
+FROM incomes
+WHERE btrim(COALESCE(source, '')) <> ''
+ORDER BY user_id, lower(btrim(source)), btrim(source)
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE incomes i
+SET payee_id = p.id
+FROM payees p
+WHERE p.user_id = i.user_id AND lower(p.name) = lower(btrim(i.source));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE incomes DROP COLUMN payee_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE expenses DROP COLUMN payee_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE payees;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX index_expenses_on_user_id_amount_date ON expenses(user_id, amount, date);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_incomes_on_user_id_amount_date ON incomes(user_id, amount, date);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX index_incomes_on_user_id_amount_date;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX index_expenses_on_user_id_amount_date;
+-- +goose StatementEnd
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS sessions (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  revoked_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_sessions_on_user_id ON sessions(user_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- every refresh token ever issued for a session is kept until the session
+-- goes, so presenting one that was already used can be recognised as reuse
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+  id BIGSERIAL PRIMARY KEY,
+  session_id BIGINT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+  token_hash BYTEA NOT NULL,
+  used_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT unique_refresh_token_hash UNIQUE (token_hash)
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_refresh_tokens_on_session_id ON refresh_tokens(session_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE refresh_tokens;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE sessions;
+-- +goose StatementEnd
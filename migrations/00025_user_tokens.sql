@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- accounts from before verification existed are trusted, so turning on
+-- REQUIRE_EMAIL_VERIFICATION does not lock them out
+UPDATE users SET email_verified = TRUE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_tokens (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  purpose TEXT NOT NULL CHECK (purpose IN ('password_reset', 'email_verification')),
+  token_hash BYTEA NOT NULL,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  used_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT unique_user_token_hash UNIQUE (token_hash)
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_user_tokens_on_user_id ON user_tokens(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE user_tokens;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE users
+DROP COLUMN email_verified;
+-- +goose StatementEnd
@@ -0,0 +1,59 @@
+-- +goose Up
+-- +goose StatementBegin
+-- enabled_at stays NULL until the user confirms the secret with a first
+-- code; last_step is the period of the last code accepted, so it cannot be
+-- used again
+CREATE TABLE IF NOT EXISTS user_totp (
+  user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  secret TEXT NOT NULL,
+  enabled_at TIMESTAMP WITH TIME ZONE,
+  last_step BIGINT NOT NULL DEFAULT 0,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS recovery_codes (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  code_hash BYTEA NOT NULL,
+  used_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT unique_recovery_code_hash UNIQUE (code_hash)
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_recovery_codes_on_user_id ON recovery_codes(user_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- the second step of a login, between a correct password and a correct code
+CREATE TABLE IF NOT EXISTS login_challenges (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token_hash BYTEA NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT unique_login_challenge_token_hash UNIQUE (token_hash)
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_login_challenges_on_user_id ON login_challenges(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE login_challenges;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE recovery_codes;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE user_totp;
+-- +goose StatementEnd
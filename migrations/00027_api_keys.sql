@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+-- prefix is the start of the key, kept in the clear so users can tell their
+-- keys apart; only a hash of the whole key is stored
+CREATE TABLE IF NOT EXISTS api_keys (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name VARCHAR(100) NOT NULL,
+  prefix TEXT NOT NULL,
+  key_hash BYTEA NOT NULL,
+  scopes JSONB NOT NULL DEFAULT '[]',
+  expires_at TIMESTAMP WITH TIME ZONE,
+  last_used_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT unique_api_key_hash UNIQUE (key_hash)
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX index_api_keys_on_user_id ON api_keys(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE api_keys;
+-- +goose StatementEnd
@@ -122,16 +122,22 @@ const (
 
 var secretKey = []byte(os.Getenv("JWT_SECRET"))
 
+// AccessTokenTTL is kept short, clients get a new access token with the
+// refresh token of their session.
+const AccessTokenTTL = 15 * time.Minute
+
 type Claims struct {
-	UserID int64 `json:"user_id"`
+	UserID    int64 `json:"user_id"`
+	SessionID int64 `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func CreateToken(user_id int64) (string, error) {
+func CreateToken(user_id int64, session_id int64) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
 		jwt.MapClaims{
 			"user_id": user_id,
-			"exp":     time.Now().Add(time.Hour * 24).Unix(),
+			"sid":     session_id,
+			"exp":     time.Now().Add(AccessTokenTTL).Unix(),
 		})
 
 	tokenString, err := token.SignedString(secretKey)